@@ -1,69 +1,294 @@
 package bsw
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/miekg/dns"
 )
 
-// AXFR attempts a zone transfer for the domain.
-func AXFR(domain, serverAddr string) *Tsk {
+// Matches hostnames used in SPF mechanisms and modifiers found in TXT records.
+var spfHostRegex = regexp.MustCompile(`(?i)(?:include|a|mx|ptr|exists|redirect|exp)[:=]([a-z0-9_.\-]+\.[a-z]{2,})`)
+
+// TSIGKey is used to sign zone transfers.
+type TSIGKey struct {
+	Name      string
+	Algorithm string
+	Secret    string
+}
+
+// Supported TSIG algorithms.
+var tsigAlgorithms = map[string]string{
+	"hmac-md5":    dns.HmacMD5,
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// ParseTSIGKey parses a TSIG key in the form [algorithm:]name:secret, the same
+// form used by dig. The secret must be base64 encoded. If algorithm is not
+// provided hmac-sha256 is used.
+func ParseTSIGKey(key string) (*TSIGKey, error) {
+	parts := strings.Split(key, ":")
+	k := &TSIGKey{Algorithm: dns.HmacSHA256}
+	switch len(parts) {
+	case 2:
+		k.Name, k.Secret = parts[0], parts[1]
+	case 3:
+		algorithm, ok := tsigAlgorithms[strings.ToLower(strings.TrimRight(parts[0], "."))]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TSIG algorithm %s", parts[0])
+		}
+		k.Algorithm, k.Name, k.Secret = algorithm, parts[1], parts[2]
+	default:
+		return nil, errors.New("TSIG key must be in the form [algorithm:]name:secret")
+	}
+	if k.Name == "" || k.Secret == "" {
+		return nil, errors.New("TSIG key name and secret are required")
+	}
+	if _, err := base64.StdEncoding.DecodeString(k.Secret); err != nil {
+		return nil, errors.New("TSIG secret must be base64 encoded")
+	}
+	return k, nil
+}
+
+// AXFR attempts a zone transfer for the domain from every address of every nameserver.
+// If a full zone transfer is refused an IXFR is attempted. Each nameserver address that
+// allows a transfer is added as a result, and hostnames are extracted from every record
+// in the transferred zone. If key is not nil, transfers are signed using TSIG.
+func AXFR(domain, serverAddr string, key *TSIGKey) *Tsk {
 	t := newTsk("axfr")
+	// Transfers may be refused by one nameserver but allowed by another.
+	defer t.keepPartial()
 	servers, err := LookupNS(domain, serverAddr)
 	if err != nil {
 		t.SetErr(err)
 		return t
 	}
 
+	records := []dns.RR{}
 	for _, s := range servers {
-		tr := dns.Transfer{}
-		m := &dns.Msg{}
-		m.SetAxfr(dns.Fqdn(domain))
-		in, err := tr.In(m, s+":53")
-		if err != nil {
-			t.SetErr(err)
-			return t
-		}
-		for ex := range in {
-			for _, a := range ex.RR {
-				var ip, hostname string
-				switch v := a.(type) {
-				case *dns.A:
-					ip = v.A.String()
-					hostname = v.Hdr.Name
-				case *dns.AAAA:
-					ip = v.AAAA.String()
-					hostname = v.Hdr.Name
-				case *dns.PTR:
-					ip = v.Hdr.Name
-					hostname = v.Ptr
-				case *dns.NS:
-					cip, err := LookupName(v.Ns, serverAddr)
-					if err != nil || len(cip) == 0 {
-						continue
-					}
-					ip = cip[0]
-					hostname = v.Ns
-				case *dns.CNAME:
-					cip, err := LookupName(v.Target, serverAddr)
-					if err != nil || len(cip) == 0 {
-						continue
-					}
-					hostname = v.Hdr.Name
-					ip = cip[0]
-				case *dns.SRV:
-					cip, err := LookupName(v.Target, serverAddr)
-					if err != nil || len(cip) == 0 {
-						continue
-					}
-					ip = cip[0]
-					hostname = v.Target
-				default:
-					continue
-				}
-				t.AddResult(ip, strings.TrimRight(hostname, "."))
+		addrs := nameserverAddrs(s, serverAddr)
+		if len(addrs) == 0 {
+			t.SetErr(fmt.Errorf("%s: unable to resolve nameserver", s))
+			continue
+		}
+		for _, addr := range addrs {
+			rrs, kind, err := transferZone(domain, addr, key)
+			if err != nil {
+				t.SetErr(fmt.Errorf("%s (%s): %v", s, addr, err))
+				continue
 			}
+			t.AddResultInfo(addr, strings.TrimRight(s, "."), kind+" allowed")
+			records = append(records, rrs...)
+		}
+	}
+	addZoneRecords(t, records, serverAddr)
+	return t
+}
+
+// AXFRServer attempts a zone transfer for the domain from a single nameserver, which may
+// include a port. This is used for authorized audits where the primary nameserver is known
+// and transfers are signed using TSIG. If key is nil the transfer is not signed.
+func AXFRServer(domain, nameserver string, key *TSIGKey, serverAddr string) *Tsk {
+	t := newTsk("axfr")
+	rrs, kind, err := transferZone(domain, nameserver, key)
+	if err != nil {
+		t.SetErr(fmt.Errorf("%s: %v", nameserver, err))
+		return t
+	}
+	host := nameserver
+	if h, _, err := net.SplitHostPort(nameserver); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) == nil {
+		for _, addr := range nameserverAddrs(host, serverAddr) {
+			t.AddResultInfo(addr, strings.TrimRight(host, "."), kind+" allowed")
 		}
 	}
+	addZoneRecords(t, rrs, serverAddr)
 	return t
 }
+
+// nameserverAddrs returns every IPv4 and IPv6 address for a nameserver.
+func nameserverAddrs(ns, serverAddr string) []string {
+	addrs := []string{}
+	if ips, err := LookupName(ns, serverAddr); err == nil {
+		addrs = append(addrs, ips...)
+	}
+	if ips, err := LookupName6(ns, serverAddr); err == nil {
+		addrs = append(addrs, ips...)
+	}
+	return addrs
+}
+
+// transferZone attempts an AXFR of zone from serverAddr, falling back to an IXFR
+// with a serial of zero. The records and the type of transfer that succeeded are returned.
+func transferZone(zone, serverAddr string, key *TSIGKey) ([]dns.RR, string, error) {
+	m := &dns.Msg{}
+	m.SetAxfr(dns.Fqdn(zone))
+	rrs, err := transfer(m, serverAddr, key)
+	if err == nil {
+		return rrs, "AXFR", nil
+	}
+	m = &dns.Msg{}
+	m.SetIxfr(dns.Fqdn(zone), 0, ".", ".")
+	// A reply with only the SOA record means the transfer was refused.
+	if rrs, ierr := transfer(m, serverAddr, key); ierr == nil && hasRecordsBeyondSOA(rrs) {
+		return rrs, "IXFR", nil
+	}
+	return nil, "", err
+}
+
+// hasRecordsBeyondSOA returns true if rrs contains any record other than a SOA.
+func hasRecordsBeyondSOA(rrs []dns.RR) bool {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != dns.TypeSOA {
+			return true
+		}
+	}
+	return false
+}
+
+// transfer performs a single zone transfer and returns every record received.
+func transfer(m *dns.Msg, serverAddr string, key *TSIGKey) ([]dns.RR, error) {
+	rrs := []dns.RR{}
+	tr := dns.Transfer{}
+	if key != nil {
+		name := strings.ToLower(dns.Fqdn(key.Name))
+		tr.TsigSecret = map[string]string{name: key.Secret}
+		m.SetTsig(name, key.Algorithm, 300, time.Now().Unix())
+	}
+	in, err := tr.In(m, serverAddress(serverAddr))
+	if err != nil {
+		return rrs, err
+	}
+	for ex := range in {
+		if ex.Error != nil {
+			return rrs, ex.Error
+		}
+		rrs = append(rrs, ex.RR...)
+	}
+	if len(rrs) == 0 {
+		return rrs, errors.New("no records returned")
+	}
+	return rrs, nil
+}
+
+// addZoneRecords adds a result for every hostname found in a list of records. Names
+// are resolved using A and AAAA records from the list when available, otherwise
+// using serverAddr.
+func addZoneRecords(t *Tsk, records []dns.RR, serverAddr string) {
+	inZone := map[string][]string{}
+	for _, rr := range records {
+		switch v := rr.(type) {
+		case *dns.A:
+			name := strings.ToLower(v.Hdr.Name)
+			inZone[name] = append(inZone[name], v.A.String())
+		case *dns.AAAA:
+			name := strings.ToLower(v.Hdr.Name)
+			inZone[name] = append(inZone[name], v.AAAA.String())
+		}
+	}
+	resolved := map[string][]string{}
+	resolve := func(name string) []string {
+		name = strings.ToLower(dns.Fqdn(name))
+		if ips, ok := inZone[name]; ok {
+			return ips
+		}
+		if ips, ok := resolved[name]; ok {
+			return ips
+		}
+		ips, _ := LookupName(name, serverAddr)
+		resolved[name] = ips
+		return ips
+	}
+	add := func(ips []string, hostnames ...string) {
+		for _, ip := range ips {
+			for _, h := range hostnames {
+				t.AddResult(ip, strings.TrimRight(h, "."))
+			}
+		}
+	}
+
+	for _, rr := range records {
+		switch v := rr.(type) {
+		case *dns.A:
+			add([]string{v.A.String()}, v.Hdr.Name)
+		case *dns.AAAA:
+			add([]string{v.AAAA.String()}, v.Hdr.Name)
+		case *dns.PTR:
+			if ip := reverseToIP(v.Hdr.Name); ip != "" {
+				add([]string{ip}, v.Ptr)
+				continue
+			}
+			add(resolve(v.Ptr), v.Ptr)
+		case *dns.NS:
+			add(resolve(v.Ns), v.Ns)
+		case *dns.CNAME:
+			ips := resolve(v.Target)
+			for _, ip := range ips {
+				t.AddResultInfo(ip, strings.TrimRight(v.Hdr.Name, "."), "CNAME "+strings.TrimRight(v.Target, "."))
+			}
+			add(ips, v.Target)
+		case *dns.SRV:
+			if v.Target == "." {
+				continue
+			}
+			// The service name is kept as info, it may include an Active Directory site.
+			for _, ip := range resolve(v.Target) {
+				t.AddResultInfo(ip, strings.TrimRight(v.Target, "."), "SRV "+strings.TrimRight(v.Hdr.Name, "."))
+			}
+		case *dns.MX:
+			add(resolve(v.Mx), v.Mx)
+		case *dns.SOA:
+			add(resolve(v.Ns), v.Ns)
+		case *dns.TXT:
+			for _, txt := range v.Txt {
+				for _, m := range spfHostRegex.FindAllStringSubmatch(txt, -1) {
+					add(resolve(m[1]), m[1])
+				}
+			}
+		}
+	}
+}
+
+// reverseToIP converts an in-addr.arpa or ip6.arpa name to an IP address. An empty
+// string is returned if name is not a complete reverse name.
+func reverseToIP(name string) string {
+	name = strings.ToLower(strings.TrimRight(name, "."))
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(labels) != 4 {
+			return ""
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		if ip := net.ParseIP(strings.Join(labels, ".")); ip != nil && ip.To4() != nil {
+			return ip.String()
+		}
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(labels) != ip6Nibbles {
+			return ""
+		}
+		nibbles := make([]byte, ip6Nibbles)
+		for i, l := range labels {
+			if len(l) != 1 || !strings.Contains("0123456789abcdef", l) {
+				return ""
+			}
+			nibbles[ip6Nibbles-1-i] = byte(strings.Index("0123456789abcdef", l))
+		}
+		return nibblesToIP(nibbles)
+	}
+	return ""
+}
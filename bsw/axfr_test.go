@@ -1,16 +1,210 @@
 package bsw
 
 import (
+	"net"
 	"testing"
+
+	"github.com/miekg/dns"
 )
 
+const testTSIGSecret = "c2VjcmV0LWtleS1mb3ItdGVzdGluZy1heGZy"
+
+// startTestAXFRServer starts an authoritative server on a random local TCP port that
+// only allows zone transfers signed with the transfer-key TSIG key.
+func startTestAXFRServer(t *testing.T, records ...string) string {
+	zone := newTestZone(t, records...)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          l,
+		TsigSecret:        map[string]string{"transfer-key.": testTSIGSecret},
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			if r.IsTsig() == nil || w.TsigStatus() != nil {
+				m := &dns.Msg{}
+				m.SetRcode(r, dns.RcodeRefused)
+				w.WriteMsg(m)
+				return
+			}
+			ch := make(chan *dns.Envelope)
+			tr := &dns.Transfer{}
+			go func() {
+				ch <- &dns.Envelope{RR: zone}
+				close(ch)
+			}()
+			tr.Out(w, r, ch)
+		}),
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return l.Addr().String()
+}
+
 func TestAXFR(t *testing.T) {
-	tsk := AXFR("zonetransfer.me", "8.8.8.8")
-	if tsk.Err() != nil {
-		t.Error("error returned from AXFR")
+	tsk := AXFR("zonetransfer.me", "8.8.8.8", nil)
+	allowed := false
+	for _, r := range tsk.Results() {
+		if r.Info == "AXFR allowed" {
+			allowed = true
+		}
+	}
+	if !allowed {
+		t.Error("no nameserver allowed AXFR")
 		t.Log(tsk.Err())
 	}
 	if len(tsk.Results()) < 10 {
 		t.Error("expected more results from AXFR")
 	}
 }
+
+func TestAddZoneRecords(t *testing.T) {
+	addr := startTestDNSServer(t, newTestZone(t,
+		"mail.provider.example. 300 IN A 198.51.100.25",
+		"spf.provider.example. 300 IN A 198.51.100.26",
+	))
+	records := []dns.RR{}
+	for _, r := range []string{
+		"example.com. 300 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 300",
+		"example.com. 300 IN NS ns1.example.com.",
+		"example.com. 300 IN MX 10 mail.provider.example.",
+		`example.com. 300 IN TXT "v=spf1 include:spf.provider.example -all"`,
+		"ns1.example.com. 300 IN A 192.0.2.53",
+		"www.example.com. 300 IN A 192.0.2.80",
+		"www.example.com. 300 IN A 192.0.2.81",
+		"www.example.com. 300 IN AAAA 2001:db8::80",
+		"web.example.com. 300 IN CNAME www.example.com.",
+		"_ldap._tcp.example.com. 300 IN SRV 0 0 389 ns1.example.com.",
+		"80.2.0.192.in-addr.arpa. 300 IN PTR www.example.com.",
+	} {
+		rr, err := dns.NewRR(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rr)
+	}
+	tsk := newTsk("axfr")
+	addZoneRecords(tsk, records, addr)
+	found := map[string]bool{}
+	for _, r := range tsk.Results() {
+		found[r.IP+" "+r.Hostname] = true
+	}
+	for _, want := range []string{
+		"192.0.2.53 ns1.example.com",
+		"192.0.2.80 www.example.com",
+		"192.0.2.81 web.example.com",
+		"2001:db8::80 web.example.com",
+		"198.51.100.25 mail.provider.example",
+		"198.51.100.26 spf.provider.example",
+	} {
+		if !found[want] {
+			t.Errorf("addZoneRecords did not return %s", want)
+		}
+	}
+}
+
+func TestReverseToIP(t *testing.T) {
+	if ip := reverseToIP("1.2.0.192.in-addr.arpa."); ip != "192.0.2.1" {
+		t.Errorf("reverseToIP returned %s", ip)
+	}
+	arpa, _ := dns.ReverseAddr("2001:db8::1")
+	if ip := reverseToIP(arpa); ip != "2001:db8::1" {
+		t.Errorf("reverseToIP returned %s", ip)
+	}
+	if ip := reverseToIP("2.0.192.in-addr.arpa."); ip != "" {
+		t.Errorf("reverseToIP returned %s for a partial name", ip)
+	}
+}
+
+func TestParseTSIGKey(t *testing.T) {
+	k, err := ParseTSIGKey("hmac-sha512:transfer-key:" + testTSIGSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Name != "transfer-key" || k.Algorithm != dns.HmacSHA512 || k.Secret != testTSIGSecret {
+		t.Error("ParseTSIGKey returned an incorrect key")
+	}
+	k, err = ParseTSIGKey("transfer-key:" + testTSIGSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Algorithm != dns.HmacSHA256 {
+		t.Error("ParseTSIGKey did not default to hmac-sha256")
+	}
+	for _, bad := range []string{"transfer-key", "hmac-foo:transfer-key:" + testTSIGSecret, "transfer-key:not base64!"} {
+		if _, err := ParseTSIGKey(bad); err == nil {
+			t.Errorf("ParseTSIGKey did not return an error for %s", bad)
+		}
+	}
+}
+
+func TestAXFRServerTSIG(t *testing.T) {
+	addr := startTestAXFRServer(t,
+		"example.com. 300 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 300",
+		"ns1.example.com. 300 IN A 192.0.2.53",
+		"intranet.example.com. 300 IN A 192.0.2.10",
+		"example.com. 300 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 300",
+	)
+
+	tsk := AXFRServer("example.com", addr, nil, addr)
+	if tsk.Err() == nil || tsk.HasResults() {
+		t.Error("AXFRServer did not fail without a TSIG key")
+	}
+
+	key := &TSIGKey{Name: "transfer-key", Algorithm: dns.HmacSHA256, Secret: testTSIGSecret}
+	tsk = AXFRServer("example.com", addr, key, addr)
+	if err := tsk.Err(); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, r := range tsk.Results() {
+		if r.IP == "192.0.2.10" && r.Hostname == "intranet.example.com" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("AXFRServer did not return records from a signed transfer")
+	}
+
+	key.Secret = "d3Jvbmcta2V5"
+	tsk = AXFRServer("example.com", addr, key, addr)
+	if tsk.Err() == nil {
+		t.Error("AXFRServer did not fail with an incorrect TSIG secret")
+	}
+}
+
+func TestTransferZoneIXFRRefused(t *testing.T) {
+	soa := "example.com. 300 IN SOA ns1.example.com. admin.example.com. 0 7200 3600 1209600 300"
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          l,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := &dns.Msg{}
+			if r.Question[0].Qtype == dns.TypeAXFR {
+				m.SetRcode(r, dns.RcodeRefused)
+				w.WriteMsg(m)
+				return
+			}
+			// Servers refuse an IXFR by replying with only their SOA record.
+			m.SetReply(r)
+			rr, _ := dns.NewRR(soa)
+			m.Answer = []dns.RR{rr}
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+	<-started
+	defer server.Shutdown()
+
+	if _, kind, err := transferZone("example.com", l.Addr().String(), nil); err == nil {
+		t.Errorf("transferZone reported %s allowed for a SOA only reply", kind)
+	}
+}
@@ -8,10 +8,20 @@ import (
 // DomainRegex is used to validate a hostname to ensure it is legitimate.
 var DomainRegex = `^\.?[a-z\d]+(?:(?:[a-z\d]*)|(?:[a-z\d\-]*[a-z\d]))(?:\.[a-z\d]+(?:(?:[a-z\d]*)|(?:[a-z\d\-]*[a-z\d])))*$`
 
+// Names of tasks whose results or domains are used by later passes, which are also the
+// source of each of their results and domains.
+const (
+	TaskHTTPWildcard     = "HTTP Wildcard"
+	TaskTLSFingerprint   = "TLS Fingerprint"
+	TaskCertificatePivot = "Certificate Pivot"
+	TaskSiblingDomain    = "Sibling Domain"
+)
+
 // Tsk is used to return the results of a task to the caller.
 type Tsk struct {
 	task    string
 	results []Result
+	domains []Domain
 	errs    []error
 }
 
@@ -38,6 +48,52 @@ func (t *Tsk) AddResult(ip, hostname string) {
 	})
 }
 
+// AddResultInfo adds a result with additional information to results.
+func (t *Tsk) AddResultInfo(ip, hostname, info string) {
+	t.results = append(t.results, Result{
+		Source:   t.task,
+		IP:       ip,
+		Hostname: hostname,
+		Info:     info,
+	})
+}
+
+// addResultSource adds a result with a source other than the name of the task.
+func (t *Tsk) addResultSource(source, ip, hostname, info string) {
+	t.results = append(t.results, Result{
+		Source:   source,
+		IP:       ip,
+		Hostname: hostname,
+		Info:     info,
+	})
+}
+
+// AddResultCert adds a result that was found in a certificate.
+func (t *Tsk) AddResultCert(ip, hostname string, cert *Certificate) {
+	t.results = append(t.results, Result{
+		Source:      t.task,
+		IP:          ip,
+		Hostname:    hostname,
+		Certificate: cert,
+	})
+}
+
+// AddDomain adds a registered domain related to the target, with its addresses if it
+// resolves.
+func (t *Tsk) AddDomain(name string, ips []string, info string) {
+	t.domains = append(t.domains, Domain{
+		Source: t.task,
+		Name:   name,
+		IPs:    ips,
+		Info:   info,
+	})
+}
+
+// Domains returns the domains.
+func (t *Tsk) Domains() []Domain {
+	return t.domains
+}
+
 // HasResults return true if len of results is greater than 0.
 func (t *Tsk) HasResults() bool {
 	return len(t.results) > 0
@@ -53,6 +109,14 @@ func (t *Tsk) SetErr(err error) {
 	t.errs = append(t.errs, err)
 }
 
+// keepPartial discards the errors of a task that found results. It is used by tasks
+// that make several independent attempts, where some are expected to fail.
+func (t *Tsk) keepPartial() {
+	if len(t.results) > 0 || len(t.domains) > 0 {
+		t.errs = nil
+	}
+}
+
 // Results returns the results.
 func (t *Tsk) Results() []Result {
 	return t.results
@@ -63,6 +127,35 @@ type Result struct {
 	Source   string `json:"src"`
 	IP       string `json:"ip"`
 	Hostname string `json:"hostname"`
+	Info     string `json:"info,omitempty"`
+	// Certificate is set for results found in a certificate. It is shared by the
+	// results found in the same handshake or log entry.
+	Certificate *Certificate `json:"certificate,omitempty"`
+}
+
+// Domain is a registered domain related to a target, such as a sibling, a lookalike or a
+// domain found in a related certificate. Domains are reported apart from results, as they
+// are not hosts of the target.
+type Domain struct {
+	Source string   `json:"src"`
+	Name   string   `json:"domain"`
+	IPs    []string `json:"ips,omitempty"`
+	Info   string   `json:"info,omitempty"`
+}
+
+// ResultKey identifies a unique result. The certificate of a result is identified by its
+// fingerprint, so that results with the same certificate are equal wherever it was read.
+type ResultKey struct {
+	Source, IP, Hostname, Info, Certificate string
+}
+
+// Key returns the ResultKey of r.
+func (r Result) Key() ResultKey {
+	k := ResultKey{Source: r.Source, IP: r.IP, Hostname: r.Hostname, Info: r.Info}
+	if r.Certificate != nil {
+		k.Certificate = r.Certificate.SHA256
+	}
+	return k
 }
 
 // Results is a slice of Result.
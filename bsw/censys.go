@@ -9,9 +9,10 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 )
 
-const censysURL = "https://www.censys.io/api/v1"
+var censysURL = "https://www.censys.io/api/v1"
 
 type censysSearchResponse struct {
 	Status  string `json:"status"`
@@ -31,12 +32,28 @@ type censysViewResponse struct {
 					Parsed struct {
 						Extensions struct {
 							SubjectAltName struct {
-								DNSNames []string `json:"dns_names"`
+								DNSNames       []string `json:"dns_names"`
+								EmailAddresses []string `json:"email_addresses"`
 							} `json:"subject_alt_name"`
 						} `json:"extensions"`
 						Subject struct {
-							CommonName []string `json:"common_name"`
+							CommonName         []string `json:"common_name"`
+							Organization       []string `json:"organization"`
+							OrganizationalUnit []string `json:"organizational_unit"`
 						} `json:"subject"`
+						SubjectDN         string `json:"subject_dn"`
+						IssuerDN          string `json:"issuer_dn"`
+						SerialNumber      string `json:"serial_number"`
+						FingerprintSHA256 string `json:"fingerprint_sha256"`
+						Validity          struct {
+							Start time.Time `json:"start"`
+							End   time.Time `json:"end"`
+						} `json:"validity"`
+						SubjectKeyInfo struct {
+							KeyAlgorithm struct {
+								Name string `json:"name"`
+							} `json:"key_algorithm"`
+						} `json:"subject_key_info"`
 					} `json:"parsed"`
 				} `json:"certificate"`
 			} `json:"tls"`
@@ -51,24 +68,13 @@ type censysViewResponse struct {
 // TLS certificates.
 func CensysDomain(domain, auth string) *Tsk {
 	t := newTsk("censys.io Domain")
-	p := 1
-	ips, pages, err := censysSearch(domain, auth, p)
+	ips, err := censysSearchAll(domain, auth)
 	if err != nil {
 		t.SetErr(err)
 		return t
 	}
-	p++
-	for p <= pages {
-		i, _, err := censysSearch(domain, auth, p)
-		if err != nil {
-			t.SetErr(err)
-			return t
-		}
-		p++
-		ips = append(ips, i...)
-	}
 	for _, ip := range ips {
-		names, err := censysView(ip, auth)
+		names, cert, err := censysView(ip, auth)
 		if err != nil {
 			t.SetErr(err)
 			return t
@@ -78,7 +84,7 @@ func CensysDomain(domain, auth string) *Tsk {
 				continue
 			}
 			if strings.Contains(n, domain) && n != domain {
-				t.AddResult(ip, n)
+				t.AddResultCert(ip, n, cert)
 			}
 		}
 	}
@@ -89,23 +95,48 @@ func CensysDomain(domain, auth string) *Tsk {
 // Hostnames are extracted from previously gathered TLS certificates.
 func CensysIP(ip, auth string) *Tsk {
 	t := newTsk("censys.io IP search")
-	names, err := censysView(ip, auth)
+	names, cert, err := censysView(ip, auth)
 	if err != nil {
 		t.SetErr(err)
 		return t
 	}
 	for _, n := range removeDuplicates(names) {
 		if ok, err := regexp.Match(DomainRegex, []byte(n)); ok && err == nil {
-			t.AddResult(ip, n)
+			t.AddResultCert(ip, n, cert)
 		}
 	}
 	return t
 }
 
-func censysSearch(domain, auth string, page int) ([]string, int, error) {
-	buf := bytes.NewBuffer([]byte(fmt.Sprintf("{\"query\": \"%s\", \"page\": %d}", domain, page)))
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/search/ipv4", censysURL), buf)
+// censysSearchAll returns the IPs from every page of results for query.
+func censysSearchAll(query, auth string) ([]string, error) {
+	p := 1
+	ips, pages, err := censysSearch(query, auth, p)
+	if err != nil {
+		return ips, err
+	}
+	p++
+	for p <= pages {
+		i, _, err := censysSearch(query, auth, p)
+		if err != nil {
+			return ips, err
+		}
+		p++
+		ips = append(ips, i...)
+	}
+	return ips, nil
+}
+
+func censysSearch(query, auth string, page int) ([]string, int, error) {
 	ips := []string{}
+	data, err := json.Marshal(struct {
+		Query string `json:"query"`
+		Page  int    `json:"page"`
+	}{query, page})
+	if err != nil {
+		return ips, 0, err
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/search/ipv4", censysURL), bytes.NewBuffer(data))
 	if err != nil {
 		return ips, 0, err
 	}
@@ -139,35 +170,56 @@ func censysSearch(domain, auth string, page int) ([]string, int, error) {
 	return ips, m.Metadata.Pages, nil
 }
 
-func censysView(ip, auth string) ([]string, error) {
+// censysView returns the names in the certificate served on port 443 of ip, along with
+// the certificate metadata. The certificate is nil if censys.io did not record one.
+func censysView(ip, auth string) ([]string, *Certificate, error) {
 	names := []string{}
 	client := &http.Client{}
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/view/ipv4/%s", censysURL, ip), nil)
 	if err != nil {
-		return names, err
+		return names, nil, err
 	}
 	parts := strings.Split(auth, ":")
 	if len(parts) != 2 {
-		return names, errors.New("Invalid auth string for censys.io")
+		return names, nil, errors.New("Invalid auth string for censys.io")
 	}
 	req.SetBasicAuth(parts[0], parts[1])
 	resp, err := client.Do(req)
 	if err != nil {
-		return names, err
+		return names, nil, err
 	}
 	if resp.StatusCode != 200 {
-		return names, errors.New("Request returned non 200 status code")
+		return names, nil, errors.New("Request returned non 200 status code")
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return names, err
+		return names, nil, err
 	}
 	m := &censysViewResponse{}
 	if err = json.Unmarshal(body, &m); err != nil {
-		return names, err
-	}
-	names = append(names, m.Num443.HTTPS.TLS.Certificate.Parsed.Extensions.SubjectAltName.DNSNames...)
-	names = append(names, m.Num443.HTTPS.TLS.Certificate.Parsed.Subject.CommonName...)
-	return names, nil
+		return names, nil, err
+	}
+	parsed := m.Num443.HTTPS.TLS.Certificate.Parsed
+	names = append(names, parsed.Extensions.SubjectAltName.DNSNames...)
+	names = append(names, parsed.Subject.CommonName...)
+	if parsed.FingerprintSHA256 == "" {
+		return names, nil, nil
+	}
+	// Only the parsed certificate is available, so it cannot be written with -cert-dump.
+	cert := &Certificate{
+		Subject:            parsed.SubjectDN,
+		Issuer:             parsed.IssuerDN,
+		Serial:             parsed.SerialNumber,
+		SHA256:             strings.ToLower(parsed.FingerprintSHA256),
+		NotBefore:          parsed.Validity.Start.UTC(),
+		NotAfter:           parsed.Validity.End.UTC(),
+		Expired:            !parsed.Validity.End.IsZero() && time.Now().After(parsed.Validity.End),
+		KeyType:            parsed.SubjectKeyInfo.KeyAlgorithm.Name,
+		Organization:       parsed.Subject.Organization,
+		OrganizationalUnit: parsed.Subject.OrganizationalUnit,
+		EmailAddresses:     parsed.Extensions.SubjectAltName.EmailAddresses,
+		DNSNames:           parsed.Extensions.SubjectAltName.DNSNames,
+	}
+	return names, cert, nil
 }
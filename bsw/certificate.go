@@ -0,0 +1,118 @@
+package bsw
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Certificate is the metadata of a certificate that names were found in.
+type Certificate struct {
+	Subject            string              `json:"subject"`
+	Issuer             string              `json:"issuer"`
+	Serial             string              `json:"serial"`
+	SHA256             string              `json:"sha256"`
+	NotBefore          time.Time           `json:"not_before"`
+	NotAfter           time.Time           `json:"not_after"`
+	Expired            bool                `json:"expired"`
+	KeyType            string              `json:"key_type"`
+	Organization       []string            `json:"organization,omitempty"`
+	OrganizationalUnit []string            `json:"organizational_unit,omitempty"`
+	EmailAddresses     []string            `json:"email_addresses,omitempty"`
+	DNSNames           []string            `json:"dns_names,omitempty"`
+	Chain              []CertificateIssuer `json:"chain,omitempty"`
+	raw                [][]byte
+	// port is the port the certificate was presented on in a handshake. It is zero for
+	// certificates read from logs, search engines or JSON.
+	port TLSPort
+}
+
+// CertificateIssuer describes a certificate in the chain presented with a certificate.
+type CertificateIssuer struct {
+	Subject string `json:"subject"`
+	Issuer  string `json:"issuer"`
+	SHA256  string `json:"sha256"`
+}
+
+// NewCertificate returns the metadata for chain, where the first certificate is the
+// leaf. Nil is returned for an empty chain.
+func NewCertificate(chain []*x509.Certificate) *Certificate {
+	if len(chain) == 0 {
+		return nil
+	}
+	leaf := chain[0]
+	c := &Certificate{
+		Subject:            leaf.Subject.String(),
+		Issuer:             leaf.Issuer.String(),
+		Serial:             fmt.Sprintf("%X", leaf.SerialNumber),
+		SHA256:             fingerprintSHA256(leaf.Raw),
+		NotBefore:          leaf.NotBefore.UTC(),
+		NotAfter:           leaf.NotAfter.UTC(),
+		Expired:            time.Now().After(leaf.NotAfter),
+		KeyType:            keyType(leaf),
+		Organization:       leaf.Subject.Organization,
+		OrganizationalUnit: leaf.Subject.OrganizationalUnit,
+		EmailAddresses:     leaf.EmailAddresses,
+		DNSNames:           leaf.DNSNames,
+		raw:                [][]byte{leaf.Raw},
+	}
+	for _, ca := range chain[1:] {
+		c.Chain = append(c.Chain, CertificateIssuer{
+			Subject: ca.Subject.String(),
+			Issuer:  ca.Issuer.String(),
+			SHA256:  fingerprintSHA256(ca.Raw),
+		})
+		c.raw = append(c.raw, ca.Raw)
+	}
+	return c
+}
+
+func fingerprintSHA256(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// keyType returns the algorithm and size of the public key in cert.
+func keyType(cert *x509.Certificate) string {
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+// PEM returns the certificate and its chain in PEM format. Certificates read from JSON
+// output do not include the encoded certificates and return nil.
+func (c *Certificate) PEM() []byte {
+	var out []byte
+	for _, der := range c.raw {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return out
+}
+
+// DumpCertificate writes the certificate and its chain in PEM format to a file named
+// after its SHA-256 fingerprint in dir.
+func DumpCertificate(dir string, c *Certificate) error {
+	data := c.PEM()
+	if data == nil {
+		return fmt.Errorf("%s: certificate data not available", c.SHA256)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, c.SHA256+".pem"), data, 0644)
+}
@@ -0,0 +1,82 @@
+package bsw
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestNewCertificate(t *testing.T) {
+	leaf := testCertificate(t, "www.example.com", "example.com").Leaf
+	c := NewCertificate([]*x509.Certificate{leaf})
+	if c.KeyType != "ECDSA P-256" || c.Expired || len(c.SHA256) != 64 {
+		t.Errorf("unexpected certificate %+v", c)
+	}
+	if len(c.Organization) != 1 || c.Organization[0] != "Example Org" {
+		t.Errorf("unexpected organization %v", c.Organization)
+	}
+	if NewCertificate([]*x509.Certificate{leaf}).SHA256 != c.SHA256 {
+		t.Error("NewCertificate did not return the same fingerprint for the same leaf")
+	}
+	if NewCertificate(nil) != nil {
+		t.Error("NewCertificate did not return nil for an empty chain")
+	}
+
+	dir := t.TempDir()
+	if err := DumpCertificate(dir, c); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, c.SHA256+".pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, _ := pem.Decode(data); block == nil || string(block.Bytes) != string(leaf.Raw) {
+		t.Error("DumpCertificate did not write the certificate")
+	}
+	if err := DumpCertificate(dir, &Certificate{SHA256: "missing"}); err == nil {
+		t.Error("DumpCertificate did not return an error for a certificate without data")
+	}
+}
+
+func TestResultKey(t *testing.T) {
+	c := NewCertificate([]*x509.Certificate{testCertificate(t, "www.example.com").Leaf})
+	r := Result{Source: "TLS Certificate", IP: "192.0.2.1", Hostname: "www.example.com", Certificate: c}
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read Result
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+	if read.Certificate == c || read.Key() != r.Key() {
+		t.Error("Key did not match for a result with the same certificate read from JSON")
+	}
+	r.Certificate = nil
+	if read.Key() == r.Key() {
+		t.Error("Key matched for results with and without a certificate")
+	}
+}
+
+func TestTLSCertificate(t *testing.T) {
+	config := &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "www.example.com", "example.com")}}
+	port := startTestTLSServer(t, "tcp", "127.0.0.1:0", config, nil)
+	ports, _ := ParseTLSPorts(strconv.Itoa(port))
+	results := TLS("127.0.0.1", ports, 2000).Results()
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %v", results)
+	}
+	for _, r := range results {
+		if r.Certificate == nil || r.Certificate != results[0].Certificate {
+			t.Error("TLS did not attach the same certificate to each result")
+		}
+	}
+	if results[0].Certificate.port != ports[0] {
+		t.Errorf("expected the certificate to be found on %v, got %v", ports[0], results[0].Certificate.port)
+	}
+}
@@ -0,0 +1,158 @@
+package bsw
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Handshakes performed by TLSFingerprint. Each offers a different range of versions,
+// cipher suites, curves and ALPN protocols, so that servers with different TLS libraries
+// or configurations choose differently for at least one of them. The order of cipher
+// suites is not sent as configured and TLS 1.3 suites can not be configured, so probes
+// differ by the suites that are offered for TLS 1.2 and by the curves and ALPN protocols
+// offered for TLS 1.3.
+var fingerprintProbes = []*tls.Config{
+	{MaxVersion: tls.VersionTLS12, NextProtos: []string{"h2", "http/1.1"}},
+	{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	}},
+	{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	}},
+	{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	}, NextProtos: []string{"http/1.1"}},
+	{MaxVersion: tls.VersionTLS12, CurvePreferences: []tls.CurveID{tls.CurveP384}, NextProtos: []string{"http/1.1", "h2"}},
+	{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11},
+	{MinVersion: tls.VersionTLS13, NextProtos: []string{"http/1.1"}},
+	{MinVersion: tls.VersionTLS13, CurvePreferences: []tls.CurveID{tls.X25519}, NextProtos: []string{"h2"}},
+	{MinVersion: tls.VersionTLS13, CurvePreferences: []tls.CurveID{tls.CurveP384}, NextProtos: []string{"h2", "http/1.1"}},
+}
+
+// TLSFingerprint performs several handshakes with ip on port and records the version,
+// cipher suite and ALPN protocol chosen for each, or that the handshake failed. The
+// choices are hashed to a fingerprint that is the same for servers using the same TLS
+// library and configuration, similar to JARM. Certificates do not affect the fingerprint.
+func TLSFingerprint(ip string, port TLSPort, timeout int64) (string, error) {
+	choices := []string{}
+	succeeded := 0
+	for _, probe := range fingerprintProbes {
+		config := probe.Clone()
+		config.InsecureSkipVerify = true
+		state, _, err := tlsHandshake(ip, port, config, timeout)
+		if err != nil {
+			choices = append(choices, "|||")
+			continue
+		}
+		succeeded++
+		choices = append(choices, fmt.Sprintf("%04x|%04x|%s|", state.Version, state.CipherSuite, state.NegotiatedProtocol))
+	}
+	if succeeded == 0 {
+		return "", errors.New(ip + ": no TLS handshakes succeeded")
+	}
+	sum := sha256.Sum256([]byte(strings.Join(choices, ",")))
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// FingerprintTargets returns the port to fingerprint for each IP of results that presented
+// a certificate in a handshake. The lowest port is used when an IP presented certificates
+// on several.
+func FingerprintTargets(results Results) map[string]TLSPort {
+	targets := map[string]TLSPort{}
+	for _, r := range results {
+		if r.Certificate == nil || r.Certificate.port.Port == 0 || r.IP == "" {
+			continue
+		}
+		if p, ok := targets[r.IP]; !ok || r.Certificate.port.Port < p.Port {
+			targets[r.IP] = r.Certificate.port
+		}
+	}
+	return targets
+}
+
+// TLSCluster computes the TLS fingerprint of ip on port. The fingerprint is returned as
+// the info of a result without a hostname.
+func TLSCluster(ip string, port TLSPort, timeout int64) *Tsk {
+	t := newTsk(TaskTLSFingerprint)
+	fingerprint, err := TLSFingerprint(ip, port, timeout)
+	if err != nil {
+		t.SetErr(err)
+		return t
+	}
+	t.AddResultInfo(ip, "", fingerprint)
+	return t
+}
+
+// Cluster is a group of IPs that share a certificate or a TLS fingerprint.
+type Cluster struct {
+	Kind      string   `json:"kind"`
+	Key       string   `json:"key"`
+	IPs       []string `json:"ips"`
+	Hostnames []string `json:"hostnames,omitempty"`
+}
+
+// Clusters groups the IPs of results by the SHA-256 fingerprint of the certificate the
+// result was found in, and by TLS fingerprint using fingerprints, a map of IP to TLS
+// fingerprint. Only groups of two or more IPs are returned, largest first.
+func Clusters(results Results, fingerprints map[string]string) []Cluster {
+	type group struct {
+		ips       map[string]bool
+		hostnames map[string]bool
+	}
+	groups := map[[2]string]*group{}
+	add := func(kind, key, ip, hostname string) {
+		k := [2]string{kind, key}
+		g, ok := groups[k]
+		if !ok {
+			g = &group{ips: map[string]bool{}, hostnames: map[string]bool{}}
+			groups[k] = g
+		}
+		g.ips[ip] = true
+		if hostname != "" {
+			g.hostnames[hostname] = true
+		}
+	}
+	for _, r := range results {
+		if r.Certificate != nil && r.IP != "" {
+			add("certificate", r.Certificate.SHA256, r.IP, r.Hostname)
+		}
+	}
+	for ip, fingerprint := range fingerprints {
+		add("tls fingerprint", fingerprint, ip, "")
+	}
+
+	clusters := []Cluster{}
+	for k, g := range groups {
+		if len(g.ips) < 2 {
+			continue
+		}
+		c := Cluster{Kind: k[0], Key: k[1]}
+		for ip := range g.ips {
+			c.IPs = append(c.IPs, ip)
+		}
+		for h := range g.hostnames {
+			c.Hostnames = append(c.Hostnames, h)
+		}
+		sort.Strings(c.IPs)
+		sort.Strings(c.Hostnames)
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].IPs) != len(clusters[j].IPs) {
+			return len(clusters[i].IPs) > len(clusters[j].IPs)
+		}
+		if clusters[i].Kind != clusters[j].Kind {
+			return clusters[i].Kind < clusters[j].Kind
+		}
+		return clusters[i].Key < clusters[j].Key
+	})
+	return clusters
+}
@@ -0,0 +1,117 @@
+package bsw
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestTLSFingerprint(t *testing.T) {
+	cert := testCertificate(t, "www.example.com")
+	modern := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12, NextProtos: []string{"h2"}}
+	legacy := &tls.Config{Certificates: []tls.Certificate{cert}, MaxVersion: tls.VersionTLS12}
+	first := TLSPort{Port: startTestTLSServer(t, "tcp", "127.0.0.1:0", modern, nil), Protocol: "tls"}
+	second := TLSPort{Port: startTestTLSServer(t, "tcp", "127.0.0.1:0", modern, nil), Protocol: "tls"}
+	third := TLSPort{Port: startTestTLSServer(t, "tcp", "127.0.0.1:0", legacy, nil), Protocol: "tls"}
+
+	fingerprints := []string{}
+	for _, p := range []TLSPort{first, second, third} {
+		f, err := TLSFingerprint("127.0.0.1", p, 2000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fingerprints = append(fingerprints, f)
+	}
+	if fingerprints[0] != fingerprints[1] {
+		t.Error("TLSFingerprint returned different fingerprints for the same configuration")
+	}
+	if fingerprints[0] == fingerprints[2] {
+		t.Error("TLSFingerprint returned the same fingerprint for different configurations")
+	}
+}
+
+func TestFingerprintProbesDiffer(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		hellos []string
+	)
+	config := &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			// Cipher suites are sorted, as their order is not meaningful.
+			suites := append([]uint16{}, hello.CipherSuites...)
+			sort.Slice(suites, func(i, j int) bool { return suites[i] < suites[j] })
+			mu.Lock()
+			hellos = append(hellos, fmt.Sprint(hello.SupportedVersions, suites, hello.SupportedCurves, hello.SupportedProtos))
+			mu.Unlock()
+			return nil, errors.New("refused")
+		},
+	}
+	port := TLSPort{Port: startTestTLSServer(t, "tcp", "127.0.0.1:0", config, nil), Protocol: "tls"}
+	TLSFingerprint("127.0.0.1", port, 2000)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hellos) != len(fingerprintProbes) {
+		t.Fatalf("expected %d handshakes from TLSFingerprint, got %d", len(fingerprintProbes), len(hellos))
+	}
+	seen := map[string]int{}
+	for i, h := range hellos {
+		if j, ok := seen[h]; ok {
+			t.Errorf("fingerprint probes %d and %d sent the same ClientHello: %s", j, i, h)
+		}
+		seen[h] = i
+	}
+}
+
+func TestFingerprintTargets(t *testing.T) {
+	https := NewCertificate([]*x509.Certificate{testCertificate(t, "www.example.com").Leaf})
+	https.port = TLSPort{Port: 443, Protocol: "tls"}
+	smtp := NewCertificate([]*x509.Certificate{testCertificate(t, "mail.example.com").Leaf})
+	smtp.port = TLSPort{Port: 25, Protocol: "smtp"}
+	logged := NewCertificate([]*x509.Certificate{testCertificate(t, "logged.example.com").Leaf})
+	targets := FingerprintTargets(Results{
+		{IP: "192.0.2.1", Hostname: "www.example.com", Certificate: https},
+		{IP: "192.0.2.1", Hostname: "mail.example.com", Certificate: smtp},
+		{IP: "192.0.2.2", Hostname: "mail.example.com", Certificate: smtp},
+		{IP: "192.0.2.3", Hostname: "logged.example.com", Certificate: logged},
+		{IP: "192.0.2.4", Hostname: "ftp.example.com"},
+	})
+	expected := map[string]TLSPort{"192.0.2.1": smtp.port, "192.0.2.2": smtp.port}
+	if len(targets) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, targets)
+	}
+	for ip, p := range expected {
+		if targets[ip] != p {
+			t.Errorf("expected %v for %s, got %v", p, ip, targets[ip])
+		}
+	}
+}
+
+func TestClusters(t *testing.T) {
+	shared := NewCertificate([]*x509.Certificate{testCertificate(t, "lb.example.com").Leaf})
+	single := NewCertificate([]*x509.Certificate{testCertificate(t, "www.example.com").Leaf})
+	results := Results{
+		{IP: "192.0.2.1", Hostname: "lb.example.com", Certificate: shared},
+		{IP: "192.0.2.2", Hostname: "lb.example.com", Certificate: shared},
+		{IP: "192.0.2.3", Hostname: "www.example.com", Certificate: single},
+		{IP: "192.0.2.4", Hostname: "mail.example.com"},
+	}
+	clusters := Clusters(results, map[string]string{
+		"192.0.2.1": "aaaa",
+		"192.0.2.3": "aaaa",
+		"192.0.2.4": "aaaa",
+		"192.0.2.2": "bbbb",
+	})
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %v", clusters)
+	}
+	if clusters[0].Kind != "tls fingerprint" || clusters[0].Key != "aaaa" || len(clusters[0].IPs) != 3 {
+		t.Errorf("unexpected cluster %v", clusters[0])
+	}
+	if clusters[1].Kind != "certificate" || clusters[1].Key != shared.SHA256 || len(clusters[1].IPs) != 2 || clusters[1].Hostnames[0] != "lb.example.com" {
+		t.Errorf("unexpected cluster %v", clusters[1])
+	}
+}
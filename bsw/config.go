@@ -14,9 +14,26 @@ type C struct {
 	IPv6           bool   `yaml:"ipv6"`
 	Server         string `yaml:"server"`
 	Reverse        bool   `yaml:"reverse"`
+	Reverse6       string `yaml:"reverse6"`
 	Headers        bool   `yaml:"headers"`
+	MaxRedirects   int    `yaml:"headers_redirects"`
+	Crawl          bool   `yaml:"crawl"`
+	CrawlDepth     int    `yaml:"crawl_depth"`
+	CrawlPages     int    `yaml:"crawl_pages"`
 	TLS            bool   `yaml:"tls"`
+	TLSPorts       string `yaml:"tls_ports"`
+	SNI            bool   `yaml:"sni"`
+	SNIMax         int    `yaml:"sni_max"`
+	VHost          bool   `yaml:"vhost"`
+	VHostMax       int    `yaml:"vhost_max"`
+	CertDump       string `yaml:"cert_dump"`
+	Cluster        string `yaml:"cluster"`
+	Pivot          bool   `yaml:"pivot"`
+	PivotAllow     string `yaml:"pivot_allow"`
+	PivotConfirm   bool   `yaml:"pivot_confirm"`
 	AXFR           bool   `yaml:"axfr"`
+	AXFRServer     string `yaml:"axfr_server"`
+	TSIG           string `yaml:"tsig"`
 	MX             bool   `yaml:"mx"`
 	NS             bool   `yaml:"ns"`
 	ViewDNSInfo    bool   `yaml:"viewdns_html"`
@@ -24,6 +41,8 @@ type C struct {
 	Robtex         bool   `yaml:"robtex"`
 	LogonTube      bool   `yaml:"logontube"`
 	SRV            bool   `yaml:"srv"`
+	SRVFile        string `yaml:"srv_file"`
+	SRVMax         int    `yaml:"srv_max"`
 	Bing           string `yaml:"bing"`
 	BingHTML       bool   `yaml:"bing_html"`
 	Shodan         string `yaml:"shodan"`
@@ -31,10 +50,25 @@ type C struct {
 	Yandex         string `yaml:"yandex"`
 	Exfil          bool   `yaml:"exfiltrated"`
 	DictFile       string `yaml:"dictionary"`
+	HTTPWildcard   string `yaml:"http_wildcard"`
+	Permute        bool   `yaml:"permute"`
+	Mask           string `yaml:"mask"`
+	Siblings       bool   `yaml:"siblings"`
+	SiblingsFile   string `yaml:"siblings_file"`
+	SiblingsAdd    bool   `yaml:"siblings_add"`
+	Typosquat      bool   `yaml:"typosquat"`
+	Learn          bool   `yaml:"learn"`
+	LearnFile      string `yaml:"learn_file"`
+	Recursive      int    `yaml:"recursive"`
+	RecursiveDict  string `yaml:"recursive_dictionary"`
+	RecursiveMax   int    `yaml:"recursive_max"`
+	PermuteWords   string `yaml:"permute_words"`
 	FCRDNS         bool   `yaml:"fcrdns"`
 	CommonCrawl    string `yaml:"cmn_crawl"`
 	CRTSH          bool   `yaml:"crtsh"`
 	VT             bool   `yaml:"vt"`
+	ZoneFile       string `yaml:"zone_file"`
+	ZoneOrigin     string `yaml:"zone_origin"`
 }
 
 // ReadConfig parses a yaml file and returns a pointer to a new config.
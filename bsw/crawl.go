@@ -0,0 +1,225 @@
+package bsw
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Defaults for the depth and number of requests of Crawl.
+const (
+	DefaultCrawlDepth = 2
+	DefaultCrawlPages = 50
+)
+
+var hostnameRegex = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,63}\b`)
+
+// Elements and attributes containing URLs, and whether the URL is a page to crawl.
+var crawlAttrs = []struct {
+	selector, attr string
+	follow         bool
+}{
+	{"a[href]", "href", true},
+	{"area[href]", "href", true},
+	{"iframe[src]", "src", true},
+	{"frame[src]", "src", true},
+	{"form[action]", "action", true},
+	{"link[href]", "href", false},
+	{"img[src]", "src", false},
+	{"script[src]", "src", false},
+}
+
+// crawlURL is a URL waiting to be requested by Crawl.
+type crawlURL struct {
+	u      *url.URL
+	depth  int
+	script bool
+}
+
+// crawler holds the state of a single crawl.
+type crawler struct {
+	t       *Tsk
+	domains []string
+	start   *url.URL
+	client  *http.Client
+	ip      string
+	// seen holds the IP and hostname of each result, so that a hostname found on several
+	// pages is returned once, with the first page it was found on.
+	seen map[[2]string]bool
+}
+
+// Crawl requests / from an IP or hostname over http and https and follows links up to
+// depth links away, making at most maxPages requests. Hostnames within domains are
+// extracted from the URLs in anchors, frames, forms, links, images and scripts, and by
+// searching inline scripts and JavaScript files. Only URLs on the target itself or on
+// hostnames within domains are requested. Each hostname is returned with the address
+// that served the page it was found in, and the URL of the page as result info.
+func Crawl(target string, domains []string, depth, maxPages int, timeout int64) *Tsk {
+	t := newTsk("HTTP Crawl")
+	defer t.keepPartial()
+	c := &crawler{t: t, domains: domains, seen: map[[2]string]bool{}}
+	c.client = &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				conn, err := net.DialTimeout(network, addr, time.Duration(timeout)*time.Millisecond)
+				if err != nil {
+					return nil, err
+				}
+				conn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Millisecond))
+				c.ip = remoteIP(conn)
+				return conn, nil
+			},
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > DefaultMaxRedirects || !c.inScope(req.URL) {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	requests := 0
+	for _, proto := range []string{"http", "https"} {
+		c.start = &url.URL{Scheme: proto, Host: urlHost(target), Path: "/"}
+		queue := []crawlURL{{u: c.start}}
+		visited := map[string]bool{c.start.String(): true}
+		for len(queue) > 0 && requests < maxPages {
+			next := queue[0]
+			queue = queue[1:]
+			requests++
+			links, err := c.visit(next)
+			if err != nil {
+				if next.u == c.start {
+					t.SetErr(err)
+				}
+				continue
+			}
+			for _, l := range links {
+				if (!l.script && l.depth > depth) || visited[l.u.String()] || !c.inScope(l.u) {
+					continue
+				}
+				visited[l.u.String()] = true
+				queue = append(queue, l)
+			}
+		}
+	}
+	if !t.HasResults() && t.Err() == nil {
+		t.SetErr(errors.New(target + ": no hostnames found"))
+	}
+	return t
+}
+
+// inScope returns true if u is on the host that the crawl started on, or on a hostname
+// within the domains of the crawl.
+func (c *crawler) inScope(u *url.URL) bool {
+	return httpInScope(u, c.start, c.domains)
+}
+
+// inDomains returns true if name is one of the domains of the crawl or beneath one.
+func (c *crawler) inDomains(name string) bool {
+	return inDomains(name, c.domains)
+}
+
+// httpInScope returns true if u is an http(s) URL on the same host as start, or on a
+// hostname within domains. It is the rule used by Crawl and Headers to decide which URLs
+// to request.
+func httpInScope(u, start *url.URL, domains []string) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	return u.Host == start.Host || inDomains(strings.ToLower(u.Hostname()), domains)
+}
+
+// inDomains returns true if name is one of domains or beneath one.
+func inDomains(name string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(strings.Trim(d, "."))
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// add returns name as a result if it is within the domains of the crawl and has not
+// already been returned for the same IP.
+func (c *crawler) add(name, source string) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if net.ParseIP(name) != nil || !c.inDomains(name) {
+		return
+	}
+	k := [2]string{c.ip, name}
+	if c.seen[k] {
+		return
+	}
+	c.seen[k] = true
+	c.t.AddResultInfo(c.ip, name, source)
+}
+
+// visit requests a URL, returns the hostnames found in it and returns the URLs it links to.
+func (c *crawler) visit(next crawlURL) ([]crawlURL, error) {
+	res, err := c.client.Get(next.u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxHTTPBody))
+	if err != nil {
+		return nil, err
+	}
+	page := res.Request.URL
+	source := page.String()
+	c.add(page.Hostname(), source)
+	contentType := strings.ToLower(res.Header.Get("Content-Type"))
+	if !strings.Contains(contentType, "html") || next.script {
+		if next.script || strings.Contains(contentType, "javascript") || strings.Contains(contentType, "json") || strings.HasPrefix(contentType, "text/") {
+			for _, name := range hostnameRegex.FindAllString(string(body), -1) {
+				c.add(name, source)
+			}
+		}
+		return nil, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	base := page
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if b, err := page.Parse(strings.TrimSpace(href)); err == nil {
+			base = b
+		}
+	}
+	links := []crawlURL{}
+	for _, a := range crawlAttrs {
+		doc.Find(a.selector).Each(func(_ int, s *goquery.Selection) {
+			value, _ := s.Attr(a.attr)
+			u, err := base.Parse(strings.TrimSpace(value))
+			if err != nil {
+				return
+			}
+			u.Fragment = ""
+			c.add(u.Hostname(), source)
+			script := a.selector == "script[src]"
+			if a.follow || script {
+				links = append(links, crawlURL{u: u, depth: next.depth + 1, script: script})
+			}
+		})
+	}
+	doc.Find("script:not([src])").Each(func(_ int, s *goquery.Selection) {
+		for _, name := range hostnameRegex.FindAllString(s.Text(), -1) {
+			c.add(name, source)
+		}
+	})
+	return links, nil
+}
@@ -0,0 +1,80 @@
+package bsw
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCrawl(t *testing.T) {
+	var mu sync.Mutex
+	requested := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<html><head><script src="/static/app.js"></script>
+				<link rel="stylesheet" href="https://cdn.example.com/site.css"></head>
+				<body><a href="/about#team">About</a><a href="https://www.other.org/">Other</a>
+				<script>var api = "https://API.example.com/v1"; var x = "tracker.other.org";</script></body></html>`)
+		case "/static/app.js":
+			w.Header().Set("Content-Type", "application/javascript")
+			io.WriteString(w, `fetch("//internal-git.corp.example.com/api");window.x="192.0.2.1";`)
+		case "/about":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<a href="/deep">deep</a><img src="http://images.example.com/logo.png">
+				<link rel="stylesheet" href="https://cdn.example.com/about.css">`)
+		case "/deep":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<form action="https://login.example.com/"></form><a href="/deeper">deeper</a>`)
+		case "/deeper":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<a href="https://hidden.example.com/">hidden</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	target := strings.TrimPrefix(ts.URL, "http://")
+
+	tsk := Crawl(target, []string{"example.com"}, 2, 50, 2000)
+	found := map[string]bool{}
+	for _, r := range tsk.Results() {
+		if r.IP != "127.0.0.1" || !strings.HasPrefix(r.Info, ts.URL) {
+			t.Errorf("unexpected result %v", r)
+		}
+		if found[r.Hostname] {
+			t.Errorf("Crawl returned %s more than once", r.Hostname)
+		}
+		found[r.Hostname] = true
+	}
+	for _, name := range []string{"cdn.example.com", "api.example.com", "internal-git.corp.example.com", "images.example.com", "login.example.com"} {
+		if !found[name] {
+			t.Errorf("Crawl did not return %s", name)
+		}
+	}
+	for _, name := range []string{"www.other.org", "tracker.other.org", "hidden.example.com"} {
+		if found[name] {
+			t.Errorf("Crawl returned %s", name)
+		}
+	}
+	if requested["/deeper"] {
+		t.Error("Crawl followed links beyond the maximum depth")
+	}
+
+	mu.Lock()
+	requested = map[string]bool{}
+	mu.Unlock()
+	Crawl(target, []string{"example.com"}, 2, 2, 2000)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requested) != 2 {
+		t.Errorf("expected 2 requests, got %v", requested)
+	}
+}
@@ -20,7 +20,7 @@ func GoogleCT(domain string) *Tsk {
 	return t
 }
 
-const crtshURL = "https://crt.sh"
+var crtshURL = "https://crt.sh"
 
 // CRTSHCT searches https://crt.sh for a list of
 // certificates
@@ -57,6 +57,7 @@ func CRTSHCT(domain, serverAddr string) *Tsk {
 		}
 
 		names := append(cert.DNSNames, cert.Subject.CommonName)
+		info := NewCertificate([]*x509.Certificate{cert})
 
 		var wg sync.WaitGroup
 		var mutex sync.Mutex
@@ -70,7 +71,7 @@ func CRTSHCT(domain, serverAddr string) *Tsk {
 				if err == nil {
 					mutex.Lock()
 					for _, ip := range ips {
-						t.AddResult(ip, name)
+						t.AddResultCert(ip, name, info)
 					}
 					mutex.Unlock()
 					return
@@ -101,7 +102,7 @@ func CRTSHCT(domain, serverAddr string) *Tsk {
 
 				mutex.Lock()
 				for _, ip := range ips {
-					t.AddResult(ip, name)
+					t.AddResultCert(ip, name, info)
 					for _, c := range cfqdns {
 						t.AddResult(ip, c)
 					}
@@ -1,36 +1,261 @@
 package bsw
 
-import "fmt"
-import "reflect"
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+)
 
-const wildcardsub = "youmustcontstuctmoreplyons."
+// Number of random labels queried when detecting a wildcard. When a wildcard is
+// found, random labels continue to be queried until wildcardStable queries in a row
+// return no new answers, so that wildcards answering from a rotating pool of
+// addresses are fully characterized.
+const (
+	wildcardProbes    = 5
+	wildcardStable    = 10
+	wildcardMaxProbes = 50
+)
 
-// GetWildCard searches for a possible wild card host by attempting to
-// get A records for wildcardsub + domain.
+// Wildcard describes the answers returned for random names beneath a domain.
+type Wildcard struct {
+	Domain string   `json:"domain"`
+	IPs    []string `json:"ips"`
+	IPs6   []string `json:"ips6"`
+	CNAMEs []string `json:"cnames"`
+}
+
+// Exists returns true if any answers were returned for random names.
+func (w *Wildcard) Exists() bool {
+	return len(w.IPs) > 0 || len(w.IPs6) > 0 || len(w.CNAMEs) > 0
+}
+
+// MatchesIPs returns true if any of ips were returned for a random name.
+func (w *Wildcard) MatchesIPs(ips []string) bool {
+	return intersects(w.IPs, ips)
+}
+
+// MatchesIPs6 returns true if any of ips were returned for a random name
+// when looking up AAAA records.
+func (w *Wildcard) MatchesIPs6(ips []string) bool {
+	return intersects(w.IPs6, ips)
+}
+
+// MatchesCNAMEs returns true if any of cnames were returned as the target
+// of a CNAME for a random name.
+func (w *Wildcard) MatchesCNAMEs(cnames []string) bool {
+	return intersects(w.CNAMEs, cnames)
+}
+
+func intersects(a, b []string) bool {
+	for _, i := range a {
+		for _, j := range b {
+			if strings.EqualFold(i, j) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// randomLabel returns a label that is unlikely to exist.
+func randomLabel() string {
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 20)
+	for i := range b {
+		b[i] = chars[rand.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+// DetectWildcard queries several random labels beneath domain and records every
+// address and CNAME target returned. If ipv6 is true, AAAA records are also queried.
+func DetectWildcard(domain, serverAddr string, ipv6 bool) *Wildcard {
+	w := &Wildcard{Domain: strings.ToLower(strings.TrimRight(domain, "."))}
+	seen := map[string]bool{}
+	add := func(list *[]string, answers ...string) bool {
+		isNew := false
+		for _, a := range answers {
+			if !seen[a] {
+				seen[a] = true
+				*list = append(*list, a)
+				isNew = true
+			}
+		}
+		return isNew
+	}
+	stable := 0
+	for i := 0; i < wildcardMaxProbes; i++ {
+		if i >= wildcardProbes && (!w.Exists() || stable >= wildcardStable) {
+			break
+		}
+		isNew := false
+		fqdn := randomLabel() + "." + domain
+		if ips, err := LookupName(fqdn, serverAddr); err == nil {
+			isNew = add(&w.IPs, ips...) || isNew
+		}
+		if ipv6 {
+			if ips, err := LookupName6(fqdn, serverAddr); err == nil {
+				isNew = add(&w.IPs6, ips...) || isNew
+			}
+		}
+		if cname, err := LookupCname(fqdn, serverAddr); err == nil {
+			isNew = add(&w.CNAMEs, cname) || isNew
+		}
+		if isNew {
+			stable = 0
+		} else {
+			stable++
+		}
+	}
+	sort.Strings(w.IPs)
+	sort.Strings(w.IPs6)
+	return w
+}
+
+// GetWildCards searches for a possible wild card host by attempting to
+// get A records for several random subdomains of domain.
 func GetWildCards(domain, serverAddr string) []string {
-	fqdn := wildcardsub + domain
-	ips, _ := LookupName(fqdn, serverAddr)
-	return ips
+	return DetectWildcard(domain, serverAddr, false).IPs
 }
 
-// GetWildCard6 searches for a possible wild card host by attempting to
-// get AAAA records wildcardsub + domain.
+// GetWildCards6 searches for a possible wild card host by attempting to
+// get AAAA records for several random subdomains of domain.
 func GetWildCards6(domain, serverAddr string) []string {
-	fqdn := wildcardsub + domain
-	ips, _ := LookupName6(fqdn, serverAddr)
-	return ips
+	return DetectWildcard(domain, serverAddr, true).IPs6
+}
+
+type wildcardEntry struct {
+	once     sync.Once
+	wildcard *Wildcard
+}
+
+// WildcardCache detects and stores the wildcard for each domain level a name is
+// guessed beneath. Each level is detected once, the first time it is used. Because
+// every level is detected separately, wildcards on sub-zones such as *.dev.example.com
+// and subdomains delegated to other nameservers are characterized independently of
+// their parent. WildcardCache is safe for concurrent use.
+type WildcardCache struct {
+	serverAddr string
+	ipv6       bool
+	mu         sync.Mutex
+	levels     map[string]*wildcardEntry
+}
+
+// NewWildcardCache returns a new WildcardCache that uses serverAddr for detection.
+func NewWildcardCache(serverAddr string, ipv6 bool) *WildcardCache {
+	return &WildcardCache{
+		serverAddr: serverAddr,
+		ipv6:       ipv6,
+		levels:     map[string]*wildcardEntry{},
+	}
+}
+
+// Get returns the wildcard for domain, detecting it if needed. A nil WildcardCache
+// returns an empty Wildcard.
+func (c *WildcardCache) Get(domain string) *Wildcard {
+	domain = strings.ToLower(strings.TrimRight(domain, "."))
+	if c == nil {
+		return &Wildcard{Domain: domain}
+	}
+	c.mu.Lock()
+	e, ok := c.levels[domain]
+	if !ok {
+		e = &wildcardEntry{}
+		c.levels[domain] = e
+	}
+	c.mu.Unlock()
+	e.once.Do(func() {
+		w := DetectWildcard(domain, c.serverAddr, c.ipv6)
+		c.mu.Lock()
+		e.wildcard = w
+		c.mu.Unlock()
+	})
+	return e.wildcard
+}
+
+// Wildcards returns every wildcard that has been detected.
+func (c *WildcardCache) Wildcards() []*Wildcard {
+	wildcards := []*Wildcard{}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.levels {
+		if e.wildcard != nil && e.wildcard.Exists() {
+			wildcards = append(wildcards, e.wildcard)
+		}
+	}
+	sort.Slice(wildcards, func(i, j int) bool { return wildcards[i].Domain < wildcards[j].Domain })
+	return wildcards
+}
+
+// parentDomain returns the name with the first label removed.
+func parentDomain(fqdn string) string {
+	parts := strings.SplitN(fqdn, ".", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// Equal returns true if w and o returned the same answers.
+func (w *Wildcard) Equal(o *Wildcard) bool {
+	return sameSet(w.IPs, o.IPs) && sameSet(w.IPs6, o.IPs6) && sameSet(w.CNAMEs, o.CNAMEs)
 }
 
-// Dictionary attempts to get an A and CNAME record for a sub domain of domain.
-func Dictionary(domain string, subname string, blacklist []string, serverAddr string) *Tsk {
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	m := map[string]bool{}
+	for _, i := range a {
+		m[strings.ToLower(i)] = true
+	}
+	for _, i := range b {
+		if !m[strings.ToLower(i)] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsDelegated returns true if name has its own NS records.
+func IsDelegated(name, serverAddr string) bool {
+	servers, err := LookupNS(name, serverAddr)
+	return err == nil && len(servers) > 0
+}
+
+// ShouldRecurse returns true if a discovered subdomain is worth guessing names beneath.
+// This is true if hasChildren is true, because other names beneath the subdomain have
+// been discovered, if the subdomain is delegated to its own nameservers, or if the
+// subdomain has a wildcard that is different from its parent's.
+func ShouldRecurse(name string, hasChildren bool, wildcards *WildcardCache, serverAddr string) bool {
+	if hasChildren || IsDelegated(name, serverAddr) {
+		return true
+	}
+	w := wildcards.Get(name)
+	return w.Exists() && !w.Equal(wildcards.Get(parentDomain(name)))
+}
+
+// Dictionary attempts to get an A and CNAME record for a sub domain of domain. Results
+// that share an address or CNAME target with the wildcard for the level the name is
+// beneath are discarded.
+func Dictionary(domain string, subname string, wildcards *WildcardCache, serverAddr string) *Tsk {
 	t := newTsk("Dictionary IPv4")
 	fqdn := subname + "." + domain
+	wildcard := wildcards.Get(parentDomain(fqdn))
 	ips, err := LookupName(fqdn, serverAddr)
 	if err == nil {
-		if reflect.DeepEqual(ips, blacklist) {
-			t.SetErr(fmt.Errorf("%v: returned IPs in blackslist", ips))
+		if wildcard.MatchesIPs(ips) {
+			t.SetErr(fmt.Errorf("%v: returned IPs in wildcard", ips))
 			return t
 		}
+		if len(wildcard.CNAMEs) > 0 {
+			if cname, err := LookupCname(fqdn, serverAddr); err == nil && wildcard.MatchesCNAMEs([]string{cname}) {
+				t.SetErr(fmt.Errorf("%v: returned CNAME in wildcard", cname))
+				return t
+			}
+		}
 		for _, ip := range ips {
 			t.AddResult(ip, fqdn)
 		}
@@ -62,22 +287,28 @@ func Dictionary(domain string, subname string, blacklist []string, serverAddr st
 		break
 	}
 
-	if reflect.DeepEqual(ips, blacklist) {
-		t.SetErr(fmt.Errorf("%v: returned IPs in blackslist", ips))
+	if wildcard.MatchesIPs(ips) || wildcard.MatchesCNAMEs(cfqdns) {
+		t.SetErr(fmt.Errorf("%v: returned IPs or CNAME in wildcard", ips))
 		return t
 	}
 	t.SetTask("Dictionary-CNAME")
 	for _, ip := range ips {
-		t.AddResult(ip, fqdn)
-		for _, c := range cfqdns {
+		t.AddResultInfo(ip, fqdn, "CNAME "+cfqdns[0])
+		for i, c := range cfqdns {
+			if i < len(cfqdns)-1 {
+				t.AddResultInfo(ip, c, "CNAME "+cfqdns[i+1])
+				continue
+			}
 			t.AddResult(ip, c)
 		}
 	}
 	return t
 }
 
-// Dictionary6 attempts to get an AAAA record for a sub domain of a domain.
-func Dictionary6(domain string, subname string, blacklist []string, serverAddr string) *Tsk {
+// Dictionary6 attempts to get an AAAA record for a sub domain of a domain. Results
+// that share an address with the wildcard for the level the name is beneath
+// are discarded.
+func Dictionary6(domain string, subname string, wildcards *WildcardCache, serverAddr string) *Tsk {
 	t := newTsk("Dictionary IPv6")
 	fqdn := subname + "." + domain
 	ips, err := LookupName6(fqdn, serverAddr)
@@ -85,8 +316,8 @@ func Dictionary6(domain string, subname string, blacklist []string, serverAddr s
 		t.SetErr(err)
 		return t
 	}
-	if reflect.DeepEqual(ips, blacklist) {
-		t.SetErr(fmt.Errorf("%v: returned IPs in blacklist", ips))
+	if wildcards.Get(parentDomain(fqdn)).MatchesIPs6(ips) {
+		t.SetErr(fmt.Errorf("%v: returned IPs in wildcard", ips))
 		return t
 	}
 	for _, ip := range ips {
@@ -1,18 +1,21 @@
 package bsw
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/miekg/dns"
 )
 
 func TestWildCard(t *testing.T) {
-	ip := GetWildCard("stacktitan.com", "8.8.8.8")
-	if ip == "" {
+	ips := GetWildCards("stacktitan.com", "8.8.8.8")
+	if len(ips) == 0 {
 		t.Error("Failed to get A record for wildcard")
 	}
 }
 
 func TestDictionary(t *testing.T) {
-	tsk := Dictionary("stacktitan.com", "foo", "", "8.8.8.8")
+	tsk := Dictionary("stacktitan.com", "foo", nil, "8.8.8.8")
 	if !tsk.HasResults() {
 		t.Fatal("Dictionary did not return any results")
 	}
@@ -27,7 +30,7 @@ func TestDictionary(t *testing.T) {
 		t.Error("Dictionary returned incorrect source")
 	}
 
-	tsk = Dictionary("stacktitan.com", "autodiscover", "", "8.8.8.8")
+	tsk = Dictionary("stacktitan.com", "autodiscover", nil, "8.8.8.8")
 	if !tsk.HasResults() {
 		t.Fatal("Dictionary did not return any results")
 	}
@@ -42,3 +45,99 @@ func TestDictionary(t *testing.T) {
 		t.Error("Dictionary returned incorrect source")
 	}
 }
+
+// wildcardZone serves example.com with a wildcard that answers from a rotating pool
+// of addresses, and dev.example.com with a wildcard CNAME to a parked page.
+type wildcardZone struct {
+	next int
+}
+
+func (z *wildcardZone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := &dns.Msg{}
+	m.SetReply(r)
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+	answer := func(s string) {
+		rr, _ := dns.NewRR(s)
+		m.Answer = append(m.Answer, rr)
+	}
+	pool := []string{"192.0.2.10", "192.0.2.11", "192.0.2.12"}
+	switch {
+	case name == "www.example.com." && q.Qtype == dns.TypeA:
+		answer(name + " 300 IN A 192.0.2.80")
+	case name == "shared.example.com." && q.Qtype == dns.TypeA:
+		answer(name + " 300 IN A 192.0.2.80")
+		answer(name + " 300 IN A 192.0.2.12")
+	case name == "api.dev.example.com.":
+		if q.Qtype == dns.TypeA {
+			answer(name + " 300 IN A 192.0.2.90")
+		}
+	case name == "parked.example.net." && q.Qtype == dns.TypeA:
+		answer(name + " 300 IN A 198.51.100.1")
+	case strings.HasSuffix(name, ".dev.example.com."):
+		answer(name + " 300 IN CNAME parked.example.net.")
+		if q.Qtype == dns.TypeA {
+			answer("parked.example.net. 300 IN A 198.51.100.1")
+		}
+	case strings.HasSuffix(name, ".example.com.") && q.Qtype == dns.TypeA:
+		answer(name + " 300 IN A " + pool[z.next%len(pool)])
+		z.next++
+	}
+	w.WriteMsg(m)
+}
+
+func TestDetectWildcard(t *testing.T) {
+	addr := startTestDNSServer(t, &wildcardZone{})
+	w := DetectWildcard("example.com", addr, false)
+	if !w.Exists() {
+		t.Fatal("DetectWildcard did not detect a wildcard")
+	}
+	if len(w.IPs) < 2 {
+		t.Error("DetectWildcard did not characterize a rotating wildcard pool")
+	}
+	w = DetectWildcard("dev.example.com", addr, false)
+	if len(w.CNAMEs) != 1 || w.CNAMEs[0] != "parked.example.net" {
+		t.Error("DetectWildcard did not return the CNAME target for a wildcard")
+	}
+}
+
+func TestDictionaryWildcards(t *testing.T) {
+	addr := startTestDNSServer(t, &wildcardZone{})
+	wildcards := NewWildcardCache(addr, false)
+	for _, sub := range []string{"www", "api.dev"} {
+		if tsk := Dictionary("example.com", sub, wildcards, addr); !tsk.HasResults() {
+			t.Errorf("Dictionary did not return a result for %s", sub)
+		}
+	}
+	for _, sub := range []string{"random1", "random2", "shared", "foo.dev"} {
+		if tsk := Dictionary("example.com", sub, wildcards, addr); tsk.HasResults() {
+			t.Errorf("Dictionary returned a wildcard result for %s", sub)
+		}
+	}
+	if n := len(wildcards.Wildcards()); n != 2 {
+		t.Errorf("expected 2 wildcards, got %d", n)
+	}
+}
+
+func TestShouldRecurse(t *testing.T) {
+	addr := startTestDNSServer(t, newTestZone(t,
+		"www.example.com. 300 IN A 192.0.2.80",
+		"corp.example.com. 300 IN NS ns1.corp.example.com.",
+	))
+	wildcards := NewWildcardCache(addr, false)
+	if ShouldRecurse("www.example.com", false, wildcards, addr) {
+		t.Error("ShouldRecurse returned true for a name without children")
+	}
+	if !ShouldRecurse("www.example.com", true, wildcards, addr) {
+		t.Error("ShouldRecurse returned false for a name with children")
+	}
+	if !ShouldRecurse("corp.example.com", false, wildcards, addr) {
+		t.Error("ShouldRecurse returned false for a delegated name")
+	}
+
+	addr = startTestDNSServer(t, &wildcardZone{})
+	wildcards = NewWildcardCache(addr, false)
+	if !ShouldRecurse("dev.example.com", false, wildcards, addr) {
+		t.Error("ShouldRecurse returned false for a name with its own wildcard")
+	}
+}
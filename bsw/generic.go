@@ -2,18 +2,61 @@ package bsw
 
 import (
 	"errors"
+	"net"
 	"sort"
 	"strings"
 
 	"github.com/miekg/dns"
 )
 
+// serverAddress returns a host:port pair for a DNS server. Port 53 is used
+// unless serverAddr already contains a port.
+func serverAddress(serverAddr string) string {
+	if _, _, err := net.SplitHostPort(serverAddr); err == nil {
+		return serverAddr
+	}
+	return net.JoinHostPort(serverAddr, "53")
+}
+
+// probeTarget returns the host of an IP address or hostname, removing any port and
+// brackets from IPv6 addresses, and whether it is an IP address.
+func probeTarget(target string) (string, bool) {
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return host, net.ParseIP(host) != nil
+}
+
+// urlHost returns target formatted for use as the host of a URL. IPv6 addresses are
+// bracketed, targets that already include a port are returned as is.
+func urlHost(target string) string {
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	host, _ := probeTarget(target)
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// remoteIP returns the IP address of the remote end of conn.
+func remoteIP(conn net.Conn) string {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	return host
+}
+
 // LookupMX returns all the mx servers for a domain.
 func LookupMX(domain, serverAddr string) ([]string, error) {
 	servers := []string{}
 	m := &dns.Msg{}
 	m.SetQuestion(dns.Fqdn(domain), dns.TypeMX)
-	in, err := dns.Exchange(m, serverAddr+":53")
+	in, err := dns.Exchange(m, serverAddress(serverAddr))
 	if err != nil {
 		return servers, err
 	}
@@ -37,7 +80,7 @@ func LookupNS(domain, serverAddr string) ([]string, error) {
 	servers := []string{}
 	m := &dns.Msg{}
 	m.SetQuestion(dns.Fqdn(domain), dns.TypeNS)
-	in, err := dns.Exchange(m, serverAddr+":53")
+	in, err := dns.Exchange(m, serverAddress(serverAddr))
 	if err != nil {
 		return servers, err
 	}
@@ -52,30 +95,24 @@ func LookupNS(domain, serverAddr string) ([]string, error) {
 	return servers, nil
 }
 
-// LookupIP returns hostname from PTR record or error.
+// LookupIP returns hostname from PTR record or error. CNAMEs in the reverse
+// zone, such as those used for RFC 2317 classless delegation, are followed.
 func LookupIP(ip, serverAddr string) ([]string, error) {
 	names := []string{}
-	m := &dns.Msg{}
 	ipArpa, err := dns.ReverseAddr(ip)
 	if err != nil {
 		return names, err
 	}
-	m.SetQuestion(ipArpa, dns.TypePTR)
-	in, err := dns.Exchange(m, serverAddr+":53")
+	ptrs, _, err := LookupPTR(ipArpa, serverAddr)
 	if err != nil {
 		return names, err
 	}
-	if len(in.Answer) < 1 {
-		return names, errors.New("no Answer")
-	}
 
-	for _, a := range in.Answer {
-		if ptr, ok := a.(*dns.PTR); ok {
-			if strings.Contains(ptr.Ptr, strings.Join(strings.Split(ip, "."), "-")) {
-				continue
-			}
-			names = append(names, strings.TrimRight(ptr.Ptr, "."))
+	for _, ptr := range ptrs {
+		if isGenericPTR(ip, ptr) {
+			continue
 		}
+		names = append(names, ptr)
 	}
 
 	if len(names) < 1 {
@@ -85,12 +122,54 @@ func LookupIP(ip, serverAddr string) ([]string, error) {
 	return names, nil
 }
 
+// isGenericPTR returns true if a PTR contains the dashed form of ip,
+// such as 192-0-2-1.isp.example.
+func isGenericPTR(ip, ptr string) bool {
+	return strings.Contains(ptr, strings.Join(strings.Split(ip, "."), "-"))
+}
+
+// LookupPTR returns the targets of PTR records for a reverse name, following up to
+// 10 CNAMEs. The CNAME targets that were followed are also returned.
+func LookupPTR(name, serverAddr string) ([]string, []string, error) {
+	ptrs := []string{}
+	cnames := []string{}
+	for i := 0; i < 10; i++ {
+		m := &dns.Msg{}
+		m.SetQuestion(dns.Fqdn(name), dns.TypePTR)
+		in, err := dns.Exchange(m, serverAddress(serverAddr))
+		if err != nil {
+			return ptrs, cnames, err
+		}
+		if len(in.Answer) < 1 {
+			return ptrs, cnames, errors.New("no Answer")
+		}
+		next := ""
+		for _, a := range in.Answer {
+			switch v := a.(type) {
+			case *dns.PTR:
+				ptrs = append(ptrs, strings.TrimRight(v.Ptr, "."))
+			case *dns.CNAME:
+				next = v.Target
+				cnames = append(cnames, strings.TrimRight(v.Target, "."))
+			}
+		}
+		if len(ptrs) > 0 {
+			return ptrs, cnames, nil
+		}
+		if next == "" {
+			return ptrs, cnames, errors.New("no PTR")
+		}
+		name = next
+	}
+	return ptrs, cnames, errors.New("too many CNAMEs")
+}
+
 // LookupName returns IPv4 addresses from A records or error.
 func LookupName(fqdn, serverAddr string) ([]string, error) {
 	ips := []string{}
 	m := &dns.Msg{}
 	m.SetQuestion(dns.Fqdn(fqdn), dns.TypeA)
-	in, err := dns.Exchange(m, serverAddr+":53")
+	in, err := dns.Exchange(m, serverAddress(serverAddr))
 	if err != nil {
 		return ips, err
 	}
@@ -115,7 +194,7 @@ func LookupName(fqdn, serverAddr string) ([]string, error) {
 func LookupCname(fqdn, serverAddr string) (string, error) {
 	m := &dns.Msg{}
 	m.SetQuestion(dns.Fqdn(fqdn), dns.TypeCNAME)
-	in, err := dns.Exchange(m, serverAddr+":53")
+	in, err := dns.Exchange(m, serverAddress(serverAddr))
 	if err != nil {
 		return "", err
 	}
@@ -134,7 +213,7 @@ func LookupName6(fqdn, serverAddr string) ([]string, error) {
 	ips := []string{}
 	m := &dns.Msg{}
 	m.SetQuestion(dns.Fqdn(fqdn), dns.TypeAAAA)
-	in, err := dns.Exchange(m, serverAddr+":53")
+	in, err := dns.Exchange(m, serverAddress(serverAddr))
 	if err != nil {
 		return ips, err
 	}
@@ -154,19 +233,25 @@ func LookupName6(fqdn, serverAddr string) ([]string, error) {
 	return ips, err
 }
 
-// LookupSRV returns a hostname from SRV record or error.
-func LookupSRV(fqdn, dnsServer string) (string, error) {
+// LookupSRV returns every SRV record for a name or error.
+func LookupSRV(fqdn, dnsServer string) ([]*dns.SRV, error) {
+	records := []*dns.SRV{}
 	m := &dns.Msg{}
 	m.SetQuestion(dns.Fqdn(fqdn), dns.TypeSRV)
-	in, err := dns.Exchange(m, dnsServer+":53")
+	in, err := dns.Exchange(m, serverAddress(dnsServer))
 	if err != nil {
-		return "", err
+		return records, err
 	}
 	if len(in.Answer) < 1 {
-		return "", errors.New("no Answer")
+		return records, errors.New("no Answer")
+	}
+	for _, a := range in.Answer {
+		if srv, ok := a.(*dns.SRV); ok {
+			records = append(records, srv)
+		}
 	}
-	if a, ok := in.Answer[0].(*dns.SRV); ok {
-		return strings.TrimRight(a.Target, "."), nil
+	if len(records) == 0 {
+		return records, errors.New("no SRV record returned")
 	}
-	return "", errors.New("no SRV record returned")
+	return records, nil
 }
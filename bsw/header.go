@@ -1,36 +1,80 @@
 package bsw
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
 	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultMaxRedirects is the number of redirects followed by Headers.
+const DefaultMaxRedirects = 5
+
+// Response headers that hostnames are extracted from, and the function used to extract
+// them from each value.
+var hostnameHeaders = []struct {
+	name    string
+	extract func(value string) []string
+}{
+	{"Location", urlHostnames},
+	{"Content-Security-Policy", cspHostnames},
+	{"Content-Security-Policy-Report-Only", cspHostnames},
+	{"Access-Control-Allow-Origin", urlHostnames},
+	{"Link", linkHostnames},
+	{"Set-Cookie", cookieHostnames},
+	{"Alt-Svc", altSvcHostnames},
+	{"Refresh", refreshHostnames},
+}
+
+var (
+	linkRegex    = regexp.MustCompile(`<([^>]+)>`)
+	altSvcRegex  = regexp.MustCompile(`="([^"]*)"`)
+	refreshRegex = regexp.MustCompile(`(?i)^\s*\d*\s*[;,]?\s*url\s*=\s*['"]?([^'"]+)`)
 )
 
-// Headers uses attempts to connect to IP over http(s).
-// If connection is successfull return any hostnames from the possible 'Location' headers.
-func Headers(ip string, timeout int64) *Tsk {
+// headerName is a hostname found in a response, the header it was found in and the
+// address of the server that returned the response.
+type headerName struct {
+	ip, hostname, header string
+}
+
+// Headers uses attempts to connect to an IP or hostname over http(s), following up to
+// maxRedirects redirects from Location and Refresh headers and meta refresh tags. Like
+// Crawl, only redirects to the target itself or to hostnames within domains are followed,
+// the hostnames of other redirects are returned without requesting them.
+// Hostnames are returned from the Location, Content-Security-Policy,
+// Access-Control-Allow-Origin, Link, Set-Cookie, Alt-Svc and Refresh headers and meta
+// refresh tags of each response, along with the address that returned the response.
+// The header each name was found in is returned as result info.
+func Headers(target string, domains []string, maxRedirects int, timeout int64) *Tsk {
 	t := newTsk("Headers")
+	defer t.keepPartial()
 	for _, proto := range []string{"http", "https"} {
-		host, err := hostnameFromHTTPLocationHeader(ip, proto, timeout)
+		names, err := hostnamesFromHTTPHeaders(target, proto, domains, maxRedirects, timeout)
 		if err != nil {
 			t.SetErr(err)
-		} else if host != "" {
-			t.AddResult(ip, host)
+		}
+		for _, n := range names {
+			t.AddResultInfo(n.ip, n.hostname, n.header)
 		}
 	}
 	return t
 }
 
-// Performs http(s) request and parses possible 'Location' headers.
-func hostnameFromHTTPLocationHeader(ip, protocol string, timeout int64) (string, error) {
-	req, err := http.NewRequest("GET", protocol+"://"+ip, nil)
-	if err != nil {
-		return "", err
-	}
+// Performs http(s) requests, following redirects, and parses the headers of each response
+// for hostnames.
+func hostnamesFromHTTPHeaders(target, protocol string, domains []string, maxRedirects int, timeout int64) ([]headerName, error) {
+	names := []headerName{}
+	seen := map[headerName]bool{}
+	var ip string
 	tr := &http.Transport{
 		Dial: func(network, addr string) (net.Conn, error) {
 			conn, err := net.DialTimeout(network, addr, time.Duration(timeout)*time.Millisecond)
@@ -38,25 +82,189 @@ func hostnameFromHTTPLocationHeader(ip, protocol string, timeout int64) (string,
 				return nil, err
 			}
 			conn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Millisecond))
+			ip = remoteIP(conn)
 			return conn, nil
 		},
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
 	}
-	res, err := tr.RoundTrip(req)
+	defer tr.CloseIdleConnections()
+	start := &url.URL{Scheme: protocol, Host: urlHost(target), Path: "/"}
+	u := start
+	visited := map[string]bool{}
+	for hop := 0; hop <= maxRedirects; hop++ {
+		visited[u.String()] = true
+		req, err := http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			return names, err
+		}
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			if hop == 0 {
+				return names, err
+			}
+			break
+		}
+		body, _ := io.ReadAll(io.LimitReader(res.Body, maxHTTPBody))
+		res.Body.Close()
+		add := func(header string, hostnames []string) {
+			for _, h := range hostnames {
+				n := headerName{ip: ip, hostname: h, header: header}
+				if !seen[n] {
+					seen[n] = true
+					names = append(names, n)
+				}
+			}
+		}
+		for _, h := range hostnameHeaders {
+			for _, value := range res.Header.Values(h.name) {
+				add(h.name, h.extract(value))
+			}
+		}
+		refresh := metaRefresh(res, body)
+		if refresh != "" {
+			add("meta refresh", refreshHostnames(refresh))
+		}
+
+		// Redirects are followed from the Location header of a redirect, then a Refresh
+		// header, then a meta refresh tag.
+		next := ""
+		if res.StatusCode >= 300 && res.StatusCode < 400 {
+			next = res.Header.Get("Location")
+		} else if r := refreshRegex.FindStringSubmatch(res.Header.Get("Refresh")); r != nil {
+			next = r[1]
+		} else if r := refreshRegex.FindStringSubmatch(refresh); r != nil {
+			next = r[1]
+		}
+		if next == "" {
+			break
+		}
+		nu, err := u.Parse(strings.TrimSpace(next))
+		if err != nil || visited[nu.String()] || !httpInScope(nu, start, domains) {
+			break
+		}
+		u = nu
+	}
+	if len(names) == 0 {
+		return names, fmt.Errorf("%v: unsuccessful header match", target)
+	}
+	return names, nil
+}
+
+// metaRefresh returns the content of a meta refresh tag in an HTML response body.
+func metaRefresh(res *http.Response, body []byte) string {
+	if !strings.Contains(strings.ToLower(res.Header.Get("Content-Type")), "html") {
+		return ""
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
-		return "", err
+		return ""
 	}
-	location := res.Header["Location"]
-	if location != nil {
-		u, err := url.Parse(location[0])
+	content := ""
+	doc.Find("meta[http-equiv]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if equiv, _ := s.Attr("http-equiv"); strings.EqualFold(strings.TrimSpace(equiv), "refresh") {
+			content, _ = s.Attr("content")
+			return false
+		}
+		return true
+	})
+	return content
+}
+
+// headerHostname returns name in lower case if it is a hostname rather than an IP
+// address, or an empty string.
+func headerHostname(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(name, "*."), "."))
+	if m, _ := regexp.MatchString(DomainRegex, name); !m || net.ParseIP(name) != nil || !strings.ContainsAny(name, "abcdefghijklmnopqrstuvwxyz") {
+		return ""
+	}
+	return name
+}
+
+// urlHostnames returns the hostname of an absolute URL.
+func urlHostnames(value string) []string {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return nil
+	}
+	if name := headerHostname(u.Hostname()); name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// cspHostnames returns the hostnames of the host sources in a Content-Security-Policy,
+// e.g. https://*.example.com:443/path.
+func cspHostnames(value string) []string {
+	names := []string{}
+	for _, directive := range strings.Split(value, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, source := range fields[1:] {
+			if strings.HasPrefix(source, "'") {
+				continue
+			}
+			if i := strings.Index(source, "://"); i != -1 {
+				source = source[i+3:]
+			} else if strings.HasSuffix(source, ":") {
+				continue
+			}
+			if i := strings.IndexAny(source, "/:"); i != -1 {
+				source = source[:i]
+			}
+			if name := headerHostname(source); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// linkHostnames returns the hostnames of the URLs in a Link header.
+func linkHostnames(value string) []string {
+	names := []string{}
+	for _, m := range linkRegex.FindAllStringSubmatch(value, -1) {
+		names = append(names, urlHostnames(m[1])...)
+	}
+	return names
+}
+
+// cookieHostnames returns the Domain attribute of a Set-Cookie header.
+func cookieHostnames(value string) []string {
+	for _, attr := range strings.Split(value, ";")[1:] {
+		parts := strings.SplitN(strings.TrimSpace(attr), "=", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "domain") {
+			if name := headerHostname(strings.TrimLeft(strings.TrimSpace(parts[1]), ".")); name != "" {
+				return []string{name}
+			}
+		}
+	}
+	return nil
+}
+
+// altSvcHostnames returns the hosts of the alternative services in an Alt-Svc header,
+// e.g. h2="alt.example.com:443".
+func altSvcHostnames(value string) []string {
+	names := []string{}
+	for _, m := range altSvcRegex.FindAllStringSubmatch(value, -1) {
+		host, _, err := net.SplitHostPort(m[1])
 		if err != nil {
-			return "", err
+			continue
 		}
-		host := u.Host
-		if m, _ := regexp.Match("[a-zA-Z]+", []byte(host)); m == true {
-			return host, nil
+		if name := headerHostname(host); name != "" {
+			names = append(names, name)
 		}
-		return "", fmt.Errorf("%v: unsuccessful header match", ip)
 	}
-	return "", fmt.Errorf("%v: unsuccessful header match", ip)
+	return names
+}
+
+// refreshHostnames returns the hostname of the URL in a Refresh header or meta refresh
+// tag, e.g. 5; url=https://www.example.com/.
+func refreshHostnames(value string) []string {
+	if m := refreshRegex.FindStringSubmatch(value); m != nil {
+		return urlHostnames(m[1])
+	}
+	return nil
 }
@@ -0,0 +1,150 @@
+package bsw
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://portal.example.com:8443/login", http.StatusFound)
+	})
+	for _, address := range []string{"127.0.0.1:0", "[::1]:0"} {
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			t.Logf("skipping %s: %v", address, err)
+			continue
+		}
+		s := httptest.NewUnstartedServer(handler)
+		s.Listener = l
+		s.Start()
+		ip := l.Addr().(*net.TCPAddr).IP.String()
+		target := net.JoinHostPort(ip, strconv.Itoa(l.Addr().(*net.TCPAddr).Port))
+		names, err := hostnamesFromHTTPHeaders(target, "http", nil, 0, 2000)
+		if err != nil {
+			t.Errorf("%s: %v", address, err)
+		} else if len(names) != 1 || names[0].hostname != "portal.example.com" || names[0].ip != ip || names[0].header != "Location" {
+			t.Errorf("%s: unexpected names %v", address, names)
+		}
+		s.Close()
+	}
+}
+
+func TestHeadersRedirectChain(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Set-Cookie", "session=1; Path=/; Domain=.sso.example.com; HttpOnly")
+			w.Header().Set("Alt-Svc", `h3=":443"; ma=86400, h2="alt.example.com:443"`)
+			http.Redirect(w, r, "/two", http.StatusMovedPermanently)
+		case "/two":
+			w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src https://*.cdn.example.com:443/js/ data: static.example.net; report-uri /csp")
+			w.Header().Set("Access-Control-Allow-Origin", "https://app.example.com")
+			w.Header().Set("Refresh", "0; url="+ts.URL+"/three")
+		case "/three":
+			w.Header().Set("Link", `<https://fonts.example.org/f.woff2>; rel=preload, </local.css>; rel=stylesheet`)
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<html><head><meta http-equiv="Refresh" content="5; URL='https://login.example.com/'"></head></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	target := strings.TrimPrefix(ts.URL, "http://")
+
+	names, err := hostnamesFromHTTPHeaders(target, "http", nil, 5, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]string{}
+	for _, n := range names {
+		found[n.hostname] = n.header
+	}
+	expected := map[string]string{
+		"sso.example.com":    "Set-Cookie",
+		"alt.example.com":    "Alt-Svc",
+		"cdn.example.com":    "Content-Security-Policy",
+		"static.example.net": "Content-Security-Policy",
+		"app.example.com":    "Access-Control-Allow-Origin",
+		"fonts.example.org":  "Link",
+		"login.example.com":  "meta refresh",
+	}
+	if len(found) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+	for name, header := range expected {
+		if found[name] != header {
+			t.Errorf("%s: expected header %s, got %q", name, header, found[name])
+		}
+	}
+
+	// Without following redirects only the first response is used.
+	names, err = hostnamesFromHTTPHeaders(target, "http", nil, 0, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Errorf("expected names from the first response only, got %v", names)
+	}
+}
+
+func TestHeadersRedirectOtherHost(t *testing.T) {
+	var (
+		ts       *httptest.Server
+		requests int32
+	)
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/other" {
+			atomic.AddInt32(&requests, 1)
+			return
+		}
+		http.Redirect(w, r, strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)+"/other", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	names, err := hostnamesFromHTTPHeaders(strings.TrimPrefix(ts.URL, "http://"), "http", nil, 5, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0].hostname != "localhost" || names[0].header != "Location" {
+		t.Errorf("expected localhost from the Location header, got %v", names)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("hostnamesFromHTTPHeaders followed a redirect to another host %d times", n)
+	}
+
+	// Redirects to hostnames within the domains are followed, as they are by Crawl.
+	if _, err := hostnamesFromHTTPHeaders(strings.TrimPrefix(ts.URL, "http://"), "http", []string{"localhost"}, 5, 2000); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected hostnamesFromHTTPHeaders to follow a redirect within the domains once, got %d", n)
+	}
+}
+
+func TestProbeTarget(t *testing.T) {
+	for target, expected := range map[string]string{
+		"192.0.2.1":          "192.0.2.1",
+		"2001:db8::1":        "[2001:db8::1]",
+		"[2001:db8::1]":      "[2001:db8::1]",
+		"[2001:db8::1]:8443": "[2001:db8::1]:8443",
+		"www.example.com":    "www.example.com",
+	} {
+		if host := urlHost(target); host != expected {
+			t.Errorf("urlHost(%s): expected %s, got %s", target, expected, host)
+		}
+	}
+	if host, isIP := probeTarget("[2001:db8::1]:8443"); host != "2001:db8::1" || !isIP {
+		t.Errorf("unexpected probeTarget result %s %v", host, isIP)
+	}
+	if host, isIP := probeTarget("www.example.com"); host != "www.example.com" || isIP {
+		t.Errorf("unexpected probeTarget result %s %v", host, isIP)
+	}
+}
@@ -0,0 +1,179 @@
+package bsw
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Maximum number of bytes read from a HTTP response body.
+const maxHTTPBody = 1 << 20
+
+// Minimum Jaccard similarity of the words in two response bodies for them to be
+// considered the same page.
+const httpSimilarity = 0.9
+
+var titleRegex = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// HTTPBaselines holds the responses for random names requested during a run, keyed by
+// protocol, IP and domain, so that each is only requested once.
+type HTTPBaselines struct {
+	mu    sync.Mutex
+	pages map[string]*httpPage
+}
+
+// NewHTTPBaselines returns an empty HTTPBaselines.
+func NewHTTPBaselines() *HTTPBaselines {
+	return &HTTPBaselines{pages: map[string]*httpPage{}}
+}
+
+// load returns the baseline stored for key and whether one was stored. A nil
+// HTTPBaselines never has a baseline.
+func (b *HTTPBaselines) load(key string) (*httpPage, bool) {
+	if b == nil {
+		return nil, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.pages[key]
+	return p, ok
+}
+
+// store records the baseline for key.
+func (b *HTTPBaselines) store(key string, p *httpPage) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pages[key] = p
+}
+
+// httpPage is a summary of a HTTP response used for comparison.
+type httpPage struct {
+	status int
+	length int
+	title  string
+	words  map[string]bool
+}
+
+// HTTPWildcard requests hostname from ip over http and https, and compares each response
+// with the response for a random name beneath the same domain. If the status, length,
+// title and body of every response is indistinguishable from the random name, the hostname
+// is likely served by a catch-all page and is returned as a result. The responses for
+// random names are reused from baselines, which may be nil.
+func HTTPWildcard(ip, hostname string, baselines *HTTPBaselines, timeout int64) *Tsk {
+	t := newTsk(TaskHTTPWildcard)
+	domain := parentDomain(hostname)
+	responded, matched := 0, 0
+	for _, proto := range []string{"http", "https"} {
+		page, err := fetchPage(proto, ip, hostname, timeout)
+		if err != nil {
+			continue
+		}
+		responded++
+		key := proto + " " + ip + " " + domain
+		baseline, ok := baselines.load(key)
+		if !ok {
+			baseline, err = fetchPage(proto, ip, randomLabel()+"."+domain, timeout)
+			if err != nil {
+				continue
+			}
+			baselines.store(key, baseline)
+		}
+		if page.similar(baseline) {
+			matched++
+		}
+	}
+	if responded == 0 {
+		t.SetErr(errors.New(hostname + ": no HTTP response"))
+		return t
+	}
+	if matched == responded {
+		t.AddResult(ip, hostname)
+	}
+	return t
+}
+
+// fetchPage performs a single request to ip, which may include a port, using hostname
+// as the Host header and TLS server name. Redirects are not followed.
+func fetchPage(protocol, ip, hostname string, timeout int64) (*httpPage, error) {
+	u := &url.URL{Scheme: protocol, Host: urlHost(ip), Path: "/"}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = hostname
+	tr := &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.DialTimeout(network, addr, time.Duration(timeout)*time.Millisecond)
+			if err != nil {
+				return nil, err
+			}
+			conn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Millisecond))
+			return conn, nil
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: hostname},
+	}
+	defer tr.CloseIdleConnections()
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxHTTPBody))
+	if err != nil {
+		return nil, err
+	}
+	// Catch-all pages often include the requested name, remove it so that pages
+	// for different names can be compared.
+	text := strings.Replace(strings.ToLower(string(body)), strings.ToLower(hostname), "", -1)
+	p := &httpPage{
+		status: res.StatusCode,
+		length: len(text),
+		words:  map[string]bool{},
+	}
+	if m := titleRegex.FindStringSubmatch(text); m != nil {
+		p.title = strings.TrimSpace(m[1])
+	}
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) {
+		p.words[w] = true
+	}
+	return p, nil
+}
+
+// similar returns true if p and o have the same status and title, lengths within ten
+// percent of each other and bodies that share most of their words.
+func (p *httpPage) similar(o *httpPage) bool {
+	if p.status != o.status || p.title != o.title {
+		return false
+	}
+	diff, longest := p.length-o.length, p.length
+	if diff < 0 {
+		diff = -diff
+	}
+	if o.length > longest {
+		longest = o.length
+	}
+	if diff*10 > longest {
+		return false
+	}
+	if len(p.words) == 0 && len(o.words) == 0 {
+		return true
+	}
+	shared := 0
+	for w := range p.words {
+		if o.words[w] {
+			shared++
+		}
+	}
+	return float64(shared)/float64(len(p.words)+len(o.words)-shared) >= httpSimilarity
+}
@@ -0,0 +1,35 @@
+package bsw
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPWildcard(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Split(r.Host, ":")[0]
+		if host == "www.example.com" {
+			fmt.Fprint(w, "<html><head><title>Example Intranet</title></head><body>Welcome to the intranet portal</body></html>")
+			return
+		}
+		fmt.Fprintf(w, "<html><head><title>Parked</title></head><body>The domain %s is parked. Buy it today!</body></html>", host)
+	}))
+	defer ts.Close()
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	baselines := NewHTTPBaselines()
+	tsk := HTTPWildcard(addr, "parked.example.com", baselines, 2000)
+	if err := tsk.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !tsk.HasResults() {
+		t.Error("HTTPWildcard did not match a catch-all page")
+	}
+	tsk = HTTPWildcard(addr, "www.example.com", baselines, 2000)
+	if tsk.HasResults() {
+		t.Error("HTTPWildcard matched a distinct page")
+	}
+}
@@ -0,0 +1,55 @@
+package bsw
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// LearnWords splits hostnames into tokens on dots, dashes and digits, and returns each
+// token ordered by the number of times it was seen, most frequent first. For hostnames
+// beneath one of domains only the labels before the domain are used, for all other
+// hostnames the last two labels are removed. Tokens shorter than two characters are skipped.
+func LearnWords(hostnames, domains []string) []string {
+	counts := map[string]int{}
+	for _, h := range hostnames {
+		h = strings.ToLower(strings.Trim(h, "."))
+		if strings.HasPrefix(h, "*.") {
+			continue
+		}
+		sub := ""
+		for _, d := range domains {
+			d = strings.ToLower(strings.Trim(d, "."))
+			if strings.HasSuffix(h, "."+d) {
+				sub = strings.TrimSuffix(h, "."+d)
+				break
+			}
+		}
+		if sub == "" {
+			labels := strings.Split(h, ".")
+			if len(labels) <= 2 {
+				continue
+			}
+			sub = strings.Join(labels[:len(labels)-2], ".")
+		}
+		for _, token := range strings.FieldsFunc(sub, func(r rune) bool {
+			return r == '.' || r == '-' || unicode.IsDigit(r)
+		}) {
+			if len(token) > 1 {
+				counts[token]++
+			}
+		}
+	}
+
+	words := []string{}
+	for w := range counts {
+		words = append(words, w)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	return words
+}
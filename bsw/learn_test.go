@@ -0,0 +1,21 @@
+package bsw
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLearnWords(t *testing.T) {
+	words := LearnWords([]string{
+		"vpn-gw01.corp.example.com",
+		"jenkins.corp.example.com",
+		"*.dev.example.com",
+		"mail.example.com",
+		"mx2.mail.example.net",
+		"x1.example.com",
+	}, []string{"example.com"})
+	expected := []string{"corp", "mail", "gw", "jenkins", "mx", "vpn"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("expected %v, got %v", expected, words)
+	}
+}
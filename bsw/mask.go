@@ -0,0 +1,232 @@
+package bsw
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Character classes that may be used in a mask.
+var maskClasses = map[byte]string{
+	'l': "abcdefghijklmnopqrstuvwxyz",
+	'd': "0123456789",
+	'h': "0123456789abcdef",
+	'a': "abcdefghijklmnopqrstuvwxyz0123456789",
+}
+
+// maskPart is a single position in a mask that may have one of several values.
+type maskPart interface {
+	Len() uint64
+	At(i uint64) string
+}
+
+// maskWords is a position that is one of a list of words or characters.
+type maskWords []string
+
+func (w maskWords) Len() uint64        { return uint64(len(w)) }
+func (w maskWords) At(i uint64) string { return w[i] }
+
+// maskRange is a position that is a number in a range, zero padded to width.
+type maskRange struct {
+	start uint64
+	end   uint64
+	width int
+}
+
+func (r maskRange) Len() uint64 { return r.end - r.start + 1 }
+
+func (r maskRange) At(i uint64) string {
+	s := strconv.FormatUint(r.start+i, 10)
+	if len(s) < r.width {
+		s = strings.Repeat("0", r.width-len(s)) + s
+	}
+	return s
+}
+
+// Mask generates subdomain names from a pattern. Names are generated as they are
+// needed, so masks that produce millions of names do not use additional memory.
+type Mask struct {
+	parts []maskPart
+}
+
+// ParseMask parses a mask. Each position in a mask is one of:
+//
+//	?l           a lowercase letter
+//	?d           a digit
+//	?h           a lowercase hex digit
+//	?a           a lowercase letter or a digit
+//	[a-f0-9_]    a character from a custom class, which may include ranges
+//	{1-20}       a number in a range
+//	{001-250}    a number in a range, zero padded to the width of the start
+//	{nyc,lon}    a word from a list
+//	{dict}       a word from words, such as the list provided to -dictionary
+//
+// Any other character is used as is. For example, srv-{nyc,lon}-{001-050} generates
+// srv-nyc-001 through srv-lon-050.
+func ParseMask(mask string, words []string) (*Mask, error) {
+	m := &Mask{}
+	literal := ""
+	flush := func() {
+		if literal != "" {
+			m.parts = append(m.parts, maskWords{literal})
+			literal = ""
+		}
+	}
+	for i := 0; i < len(mask); i++ {
+		switch c := mask[i]; c {
+		case '?':
+			if i+1 >= len(mask) {
+				return nil, fmt.Errorf("mask ends with ?")
+			}
+			i++
+			if mask[i] == '?' {
+				literal += "?"
+				continue
+			}
+			class, ok := maskClasses[mask[i]]
+			if !ok {
+				return nil, fmt.Errorf("unknown character class ?%c", mask[i])
+			}
+			flush()
+			m.parts = append(m.parts, maskWords(strings.Split(class, "")))
+		case '[':
+			end := strings.IndexByte(mask[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated [ in mask")
+			}
+			chars, err := parseMaskClass(mask[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			m.parts = append(m.parts, chars)
+			i += end
+		case '{':
+			end := strings.IndexByte(mask[i:], '}')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated { in mask")
+			}
+			part, err := parseMaskGroup(mask[i+1:i+end], words)
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			m.parts = append(m.parts, part)
+			i += end
+		default:
+			literal += strings.ToLower(string(c))
+		}
+	}
+	flush()
+	if len(m.parts) == 0 {
+		return nil, fmt.Errorf("mask is empty")
+	}
+	return m, nil
+}
+
+// parseMaskClass parses the contents of a custom character class such as a-f0-9.
+func parseMaskClass(class string) (maskWords, error) {
+	chars := maskWords{}
+	seen := map[string]bool{}
+	add := func(c byte) {
+		s := strings.ToLower(string(c))
+		if !seen[s] {
+			seen[s] = true
+			chars = append(chars, s)
+		}
+	}
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			if class[i] > class[i+2] {
+				return nil, fmt.Errorf("invalid range %s in mask", class[i:i+3])
+			}
+			for c := class[i]; c <= class[i+2]; c++ {
+				add(c)
+			}
+			i += 2
+			continue
+		}
+		add(class[i])
+	}
+	if len(chars) == 0 {
+		return nil, fmt.Errorf("empty character class in mask")
+	}
+	return chars, nil
+}
+
+// parseMaskGroup parses the contents of a numeric range, word list or {dict}.
+func parseMaskGroup(group string, words []string) (maskPart, error) {
+	if group == "dict" {
+		if len(words) == 0 {
+			return nil, fmt.Errorf("{dict} used in mask without a dictionary")
+		}
+		return maskWords(words), nil
+	}
+	if bounds := strings.SplitN(group, "-", 2); len(bounds) == 2 {
+		start, serr := strconv.ParseUint(bounds[0], 10, 64)
+		end, eerr := strconv.ParseUint(bounds[1], 10, 64)
+		if serr == nil && eerr == nil {
+			if start > end {
+				return nil, fmt.Errorf("invalid range {%s} in mask", group)
+			}
+			width := 0
+			if len(bounds[0]) > 1 && bounds[0][0] == '0' {
+				width = len(bounds[0])
+			}
+			return maskRange{start: start, end: end, width: width}, nil
+		}
+	}
+	list := maskWords{}
+	for _, w := range strings.Split(group, ",") {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			list = append(list, w)
+		}
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("empty word list in mask")
+	}
+	return list, nil
+}
+
+// Count returns the number of names the mask generates. If the number is larger than
+// can be stored, math.MaxUint64 is returned.
+func (m *Mask) Count() uint64 {
+	count := uint64(1)
+	for _, p := range m.parts {
+		n := p.Len()
+		if n != 0 && count > math.MaxUint64/n {
+			return math.MaxUint64
+		}
+		count *= n
+	}
+	return count
+}
+
+// Each calls fn with every name the mask generates, in order, until fn returns false.
+func (m *Mask) Each(fn func(name string) bool) {
+	idx := make([]uint64, len(m.parts))
+	vals := make([]string, len(m.parts))
+	for i, p := range m.parts {
+		vals[i] = p.At(0)
+	}
+	for {
+		if !fn(strings.Join(vals, "")) {
+			return
+		}
+		// Advance the rightmost position, carrying into those before it.
+		i := len(m.parts) - 1
+		for ; i >= 0; i-- {
+			idx[i]++
+			if idx[i] < m.parts[i].Len() {
+				vals[i] = m.parts[i].At(idx[i])
+				break
+			}
+			idx[i] = 0
+			vals[i] = m.parts[i].At(0)
+		}
+		if i < 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package bsw
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func maskNames(m *Mask) []string {
+	names := []string{}
+	m.Each(func(name string) bool {
+		names = append(names, name)
+		return true
+	})
+	return names
+}
+
+func TestParseMask(t *testing.T) {
+	m, err := ParseMask("srv-{nyc,LON}-{008-010}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"srv-nyc-008", "srv-nyc-009", "srv-nyc-010", "srv-lon-008", "srv-lon-009", "srv-lon-010"}
+	if names := maskNames(m); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+	if m.Count() != 6 {
+		t.Errorf("expected a count of 6, got %d", m.Count())
+	}
+
+	m, err = ParseMask("[a-c]?d{dict}", []string{"www", "mail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := maskNames(m)
+	if len(names) != 60 || uint64(len(names)) != m.Count() || names[0] != "a0www" || names[59] != "c9mail" {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	m, _ = ParseMask("?a?a?a?a?a?a?a?a?a?a?a?a?a", nil)
+	if m.Count() != math.MaxUint64 {
+		t.Error("Count did not saturate for a large mask")
+	}
+	n := 0
+	m.Each(func(string) bool {
+		n++
+		return n < 5
+	})
+	if n != 5 {
+		t.Error("Each did not stop when fn returned false")
+	}
+
+	for _, bad := range []string{"", "?x", "abc?", "[a-c", "{1-5", "{dict}", "[z-a]", "{5-1}"} {
+		if _, err := ParseMask(bad, nil); err == nil {
+			t.Errorf("ParseMask did not return an error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package bsw
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Environment tokens that are swapped with each other when generating permutations.
+var environmentTokens = []string{"dev", "development", "stage", "staging", "stg", "prod", "production", "prd",
+	"test", "testing", "qa", "uat", "preprod", "sandbox", "demo", "int"}
+
+// PermutationWords is the built-in list of words used by Permutations.
+var PermutationWords = append([]string{"api", "admin", "app", "apps", "auth", "beta", "backup", "cdn", "corp",
+	"db", "docs", "gw", "internal", "intranet", "legacy", "mail", "mgmt", "new", "old", "portal",
+	"remote", "secure", "sso", "static", "v1", "v2", "vpn", "web", "www"}, environmentTokens...)
+
+var numberRegex = regexp.MustCompile(`\d+`)
+
+// Permutations returns alterations of sub, the labels of a discovered hostname beneath
+// a domain (e.g. web01.dev for web01.dev.example.com). Words are added as a new label and
+// joined to the first label with and without a dash, numbers are incremented and
+// decremented, environment tokens are swapped, and labels are joined with dashes or
+// split on dashes. The returned names do not include sub and are also relative to the domain.
+func Permutations(sub string, words []string) []string {
+	sub = strings.ToLower(strings.Trim(sub, "."))
+	if sub == "" {
+		return []string{}
+	}
+	labels := strings.Split(sub, ".")
+	first, rest := labels[0], strings.Join(labels[1:], ".")
+	join := func(label string) string {
+		if rest == "" {
+			return label
+		}
+		return label + "." + rest
+	}
+
+	perms := []string{}
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w == "" {
+			continue
+		}
+		perms = append(perms,
+			w+"."+sub,
+			join(w+"-"+first),
+			join(first+"-"+w),
+			join(w+first),
+			join(first+w),
+		)
+	}
+
+	// Increment and decrement each number in each label, keeping any zero padding.
+	for i, label := range labels {
+		for _, loc := range numberRegex.FindAllStringIndex(label, -1) {
+			digits := label[loc[0]:loc[1]]
+			n, err := strconv.Atoi(digits)
+			if err != nil {
+				continue
+			}
+			for _, d := range []int{-3, -2, -1, 1, 2, 3} {
+				if n+d < 0 {
+					continue
+				}
+				num := strconv.Itoa(n + d)
+				if len(num) < len(digits) {
+					num = strings.Repeat("0", len(digits)-len(num)) + num
+				}
+				perms = append(perms, replaceLabel(labels, i, label[:loc[0]]+num+label[loc[1]:]))
+			}
+		}
+	}
+
+	// Swap environment tokens, matching whole labels or dash separated parts of a label.
+	for i, label := range labels {
+		parts := strings.Split(label, "-")
+		for j, part := range parts {
+			if !isEnvironmentToken(part) {
+				continue
+			}
+			for _, env := range environmentTokens {
+				if env == part {
+					continue
+				}
+				swapped := append([]string{}, parts...)
+				swapped[j] = env
+				perms = append(perms, replaceLabel(labels, i, strings.Join(swapped, "-")))
+			}
+		}
+	}
+
+	// Join adjacent labels with a dash, and split dashed labels into separate labels.
+	for i := 0; i < len(labels)-1; i++ {
+		joined := append(append(append([]string{}, labels[:i]...), labels[i]+"-"+labels[i+1]), labels[i+2:]...)
+		perms = append(perms, strings.Join(joined, "."))
+	}
+	for i, label := range labels {
+		if strings.Contains(label, "-") {
+			perms = append(perms, replaceLabel(labels, i, strings.Replace(label, "-", ".", -1)))
+		}
+	}
+
+	out := []string{}
+	seen := map[string]bool{sub: true}
+	for _, p := range perms {
+		p = strings.Trim(p, ".-")
+		if seen[p] || strings.Contains(p, "..") {
+			continue
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	return out
+}
+
+func isEnvironmentToken(s string) bool {
+	for _, env := range environmentTokens {
+		if s == env {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceLabel returns labels joined with a dot, with the label at i replaced.
+func replaceLabel(labels []string, i int, label string) string {
+	replaced := append([]string{}, labels...)
+	replaced[i] = label
+	return strings.Join(replaced, ".")
+}
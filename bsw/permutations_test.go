@@ -0,0 +1,41 @@
+package bsw
+
+import (
+	"testing"
+)
+
+func TestPermutations(t *testing.T) {
+	perms := Permutations("web01.dev", []string{"api"})
+	found := map[string]bool{}
+	for _, p := range perms {
+		found[p] = true
+	}
+	for _, want := range []string{
+		"api.web01.dev",
+		"api-web01.dev",
+		"web01-api.dev",
+		"web02.dev",
+		"web00.dev",
+		"web04.dev",
+		"web01.prod",
+		"web01.staging",
+		"web01-dev",
+	} {
+		if !found[want] {
+			t.Errorf("Permutations did not return %s", want)
+		}
+	}
+	if found["web01.dev"] {
+		t.Error("Permutations returned the original name")
+	}
+
+	found = map[string]bool{}
+	for _, p := range Permutations("app-stage", nil) {
+		found[p] = true
+	}
+	for _, want := range []string{"app-prod", "app.stage"} {
+		if !found[want] {
+			t.Errorf("Permutations did not return %s", want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package bsw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PivotValue is a value identifying the owner of a certificate, such as the organization
+// in its subject, that other certificates can be searched for.
+type PivotValue struct {
+	Kind  string
+	Value string
+}
+
+// Parameters used to search crt.sh for each kind of pivot value.
+var crtshPivotParams = map[string]string{
+	"organization":        "O",
+	"organizational unit": "OU",
+	"email":               "E",
+}
+
+// Fields of the censys.io IPv4 index searched for each kind of pivot value.
+var censysPivotFields = map[string]string{
+	"organization":        "443.https.tls.certificate.parsed.subject.organization",
+	"organizational unit": "443.https.tls.certificate.parsed.subject.organizational_unit",
+	"email":               "443.https.tls.certificate.parsed.extensions.subject_alt_name.email_addresses",
+}
+
+// PivotValues returns the subject organizations, organizational units and email addresses
+// of the certificates that results were found in, sorted by kind and value.
+func PivotValues(results Results) []PivotValue {
+	seen := map[PivotValue]bool{}
+	values := []PivotValue{}
+	add := func(kind string, list []string) {
+		for _, v := range list {
+			v = strings.TrimSpace(v)
+			if kind == "email" {
+				v = strings.ToLower(v)
+			}
+			p := PivotValue{Kind: kind, Value: v}
+			if v == "" || seen[p] {
+				continue
+			}
+			seen[p] = true
+			values = append(values, p)
+		}
+	}
+	for _, r := range results {
+		if r.Certificate == nil {
+			continue
+		}
+		add("organization", r.Certificate.Organization)
+		add("organizational unit", r.Certificate.OrganizationalUnit)
+		add("email", r.Certificate.EmailAddresses)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Kind != values[j].Kind {
+			return values[i].Kind < values[j].Kind
+		}
+		return values[i].Value < values[j].Value
+	})
+	return values
+}
+
+// RegistrableDomain returns the registrable domain of name, e.g. example.co.uk for
+// www.example.co.uk, or an empty string if name is not a hostname.
+func RegistrableDomain(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(strings.Trim(name, "."), "*."))
+	if ok, err := regexp.MatchString(DomainRegex, name); !ok || err != nil || net.ParseIP(name) != nil {
+		return ""
+	}
+	label, suffix := SplitDomain(name)
+	if label == "" {
+		return ""
+	}
+	return label + "." + suffix
+}
+
+// CertificatePivot searches crt.sh, and censys.io when censysAuth is not empty, for
+// certificates containing value. The registrable domains of the names in those
+// certificates that are not registrable domains of domains are returned as domains, with
+// the value that led to them as info. The domain of an
+// email address is also returned.
+func CertificatePivot(value PivotValue, domains []string, censysAuth string) *Tsk {
+	t := newTsk(TaskCertificatePivot)
+	defer t.keepPartial()
+	known := map[string]bool{}
+	for _, d := range domains {
+		known[RegistrableDomain(d)] = true
+	}
+	info := value.Kind + " " + value.Value
+	add := func(names []string) {
+		for _, n := range names {
+			domain := RegistrableDomain(n)
+			if domain == "" || known[domain] {
+				continue
+			}
+			known[domain] = true
+			t.AddDomain(domain, nil, info)
+		}
+	}
+	if value.Kind == "email" {
+		if i := strings.LastIndex(value.Value, "@"); i != -1 {
+			add([]string{value.Value[i+1:]})
+		}
+	}
+	names, err := crtshPivot(value)
+	if err != nil {
+		t.SetErr(fmt.Errorf("crt.sh %s: %v", info, err))
+	}
+	add(names)
+	if censysAuth == "" {
+		return t
+	}
+	field, ok := censysPivotFields[value.Kind]
+	if !ok {
+		return t
+	}
+	ips, err := censysSearchAll(fmt.Sprintf("%s: %q", field, value.Value), censysAuth)
+	if err != nil {
+		t.SetErr(fmt.Errorf("censys.io %s: %v", info, err))
+		return t
+	}
+	for _, ip := range ips {
+		names, _, err := censysView(ip, censysAuth)
+		if err != nil {
+			t.SetErr(fmt.Errorf("censys.io %s %s: %v", info, ip, err))
+			continue
+		}
+		add(names)
+	}
+	return t
+}
+
+type crtshEntry struct {
+	CommonName string `json:"common_name"`
+	NameValue  string `json:"name_value"`
+}
+
+// crtshPivot returns the names in the certificates logged to crt.sh that contain value.
+func crtshPivot(value PivotValue) ([]string, error) {
+	param, ok := crtshPivotParams[value.Kind]
+	if !ok {
+		return nil, errors.New("unsupported pivot " + value.Kind)
+	}
+	resp, err := http.Get(fmt.Sprintf("%s/?%s=%s&output=json", crtshURL, param, url.QueryEscape(value.Value)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Request returned non 200 status code")
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	entries := []crtshEntry{}
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.CommonName)
+		names = append(names, strings.Split(e.NameValue, "\n")...)
+	}
+	return removeDuplicates(names), nil
+}
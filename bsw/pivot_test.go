@@ -0,0 +1,97 @@
+package bsw
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPivotValues(t *testing.T) {
+	cert := &Certificate{
+		SHA256:             "a",
+		Organization:       []string{"Example Org"},
+		OrganizationalUnit: []string{"IT", ""},
+		EmailAddresses:     []string{"Hostmaster@Example-Corp.de"},
+	}
+	results := Results{
+		{Hostname: "www.example.com", Certificate: cert},
+		{Hostname: "mail.example.com", Certificate: cert},
+		{Hostname: "ftp.example.com"},
+	}
+	expected := []PivotValue{
+		{"email", "hostmaster@example-corp.de"},
+		{"organization", "Example Org"},
+		{"organizational unit", "IT"},
+	}
+	values := PivotValues(results)
+	if fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	for name, expected := range map[string]string{
+		"www.example.co.uk": "example.co.uk",
+		"*.Example.com":     "example.com",
+		"example.com.":      "example.com",
+		"192.0.2.1":         "",
+		"localhost":         "",
+		"bad name.com":      "",
+	} {
+		if domain := RegistrableDomain(name); domain != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, domain)
+		}
+	}
+}
+
+func TestCertificatePivot(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/" && r.URL.Query().Get("O") == "Example Org" && r.URL.Query().Get("output") == "json":
+			fmt.Fprint(w, `[{"common_name":"www.example.com","name_value":"www.example.com\nshop.example-shop.de"},
+				{"common_name":"*.examplecloud.io","name_value":"*.examplecloud.io"}]`)
+		case r.URL.Path == "/search/ipv4":
+			// The view of the first IP fails, the second is still searched.
+			fmt.Fprint(w, `{"status":"ok","results":[{"ip":"192.0.2.2"},{"ip":"192.0.2.1"}],"metadata":{"pages":1}}`)
+		case r.URL.Path == "/view/ipv4/192.0.2.1":
+			fmt.Fprint(w, `{"443":{"https":{"tls":{"certificate":{"parsed":{
+				"subject":{"common_name":["vpn.example-group.net"],"organization":["Example Org"]},
+				"fingerprint_sha256":"AB01"}}}}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	defer func(crtsh, censys string) { crtshURL, censysURL = crtsh, censys }(crtshURL, censysURL)
+	crtshURL, censysURL = ts.URL, ts.URL
+
+	tsk := CertificatePivot(PivotValue{"organization", "Example Org"}, []string{"example.com"}, "id:secret")
+	if err := tsk.Err(); err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	if tsk.HasResults() {
+		t.Errorf("CertificatePivot returned domains as results %v", tsk.Results())
+	}
+	for _, d := range tsk.Domains() {
+		if len(d.IPs) != 0 || d.Info != "organization Example Org" {
+			t.Errorf("unexpected domain %v", d)
+		}
+		found[d.Name] = true
+	}
+	expected := []string{"example-shop.de", "examplecloud.io", "example-group.net"}
+	if len(found) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, tsk.Domains())
+	}
+	for _, name := range expected {
+		if !found[name] {
+			t.Errorf("CertificatePivot did not return %s", name)
+		}
+	}
+
+	tsk = CertificatePivot(PivotValue{"email", "admin@example-corp.fr"}, []string{"example.com"}, "")
+	if domains := tsk.Domains(); len(domains) != 1 || domains[0].Name != "example-corp.fr" {
+		t.Errorf("CertificatePivot did not return the domain of the email address, got %v", domains)
+	}
+}
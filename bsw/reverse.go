@@ -1,15 +1,137 @@
 package bsw
 
-// Reverse uses LookupIP to get PTR record for an IP.
-func Reverse(ip, serverAddr string) *Tsk {
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// The label added beneath the parent zone by RFC 2317 classless delegations, such as
+// 0/25 or 0-127.
+var classlessLabel = regexp.MustCompile(`^[0-9]+[-/][0-9]+$`)
+
+// ClasslessZones records the classless delegation zones that have been reported by
+// Reverse. Every address in a delegated block points to the same zone, so it is only
+// reported and transferred once.
+type ClasslessZones struct {
+	mu    sync.Mutex
+	zones map[string]bool
+}
+
+// NewClasslessZones returns an empty ClasslessZones.
+func NewClasslessZones() *ClasslessZones {
+	return &ClasslessZones{zones: map[string]bool{}}
+}
+
+// claim returns true the first time it is called for zone.
+func (c *ClasslessZones) claim(zone string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.zones[zone] {
+		return false
+	}
+	c.zones[zone] = true
+	return true
+}
+
+// Reverse uses LookupPTR to get PTR record for an IP. If the reverse name is a CNAME into
+// a RFC 2317 classless delegation zone, the nameservers of the zone are reported and a
+// zone transfer of the delegated zone is attempted. Each zone is only followed once for
+// zones, which may be nil to follow every zone.
+func Reverse(ip, serverAddr string, zones *ClasslessZones) *Tsk {
 	t := newTsk("Reverse")
-	hostname, err := LookupIP(ip, serverAddr)
+	ipArpa, err := dns.ReverseAddr(ip)
 	if err != nil {
 		t.SetErr(err)
 		return t
 	}
-	for _, host := range hostname {
+	ptrs, cnames, err := LookupPTR(ipArpa, serverAddr)
+	for _, host := range ptrs {
+		if isGenericPTR(ip, host) {
+			continue
+		}
 		t.AddResult(ip, host)
 	}
+	if zone := classlessZone(ipArpa, cnames); zone != "" {
+		if zones == nil || zones.claim(zone) {
+			classlessDelegation(t, ip, zone, serverAddr)
+		}
+	}
+	if !t.HasResults() {
+		if err == nil {
+			err = errors.New("no PTR")
+		}
+		t.SetErr(err)
+	}
 	return t
 }
+
+// classlessZone returns the zone a reverse name has been delegated to using a CNAME,
+// or an empty string if the name is not delegated. Only CNAMEs following RFC 2317, to
+// the same first label in a zone such as 0/25 beneath the parent zone, are delegations.
+func classlessZone(ipArpa string, cnames []string) string {
+	labels := strings.SplitN(strings.ToLower(dns.Fqdn(ipArpa)), ".", 2)
+	if len(labels) != 2 || !strings.HasSuffix(labels[1], ".in-addr.arpa.") {
+		return ""
+	}
+	for _, c := range cnames {
+		parts := strings.SplitN(strings.ToLower(dns.Fqdn(c)), ".", 3)
+		if len(parts) != 3 || parts[0] != labels[0] || parts[2] != labels[1] {
+			continue
+		}
+		if classlessLabel.MatchString(parts[1]) {
+			return strings.TrimRight(parts[1]+"."+parts[2], ".")
+		}
+	}
+	return ""
+}
+
+// classlessDelegation reports the nameservers of a classless delegation zone, with the
+// zone as result info, then attempts a zone transfer of the zone from each nameserver
+// address until one succeeds. PTR records from the zone are added as results.
+func classlessDelegation(t *Tsk, ip, zone, serverAddr string) {
+	servers, err := LookupNS(zone, serverAddr)
+	if err != nil {
+		return
+	}
+	addrs := []string{}
+	for _, s := range servers {
+		ips, err := LookupName(s, serverAddr)
+		if err != nil {
+			continue
+		}
+		for _, nsip := range ips {
+			t.addResultSource("Reverse Classless Delegation", nsip, strings.TrimRight(s, "."), "nameserver of "+zone)
+		}
+		addrs = append(addrs, ips...)
+	}
+
+	// The first three octets of every address in the delegated zone are the same
+	// as the address being looked up.
+	octets := strings.Split(ip, ".")
+	if len(octets) != 4 {
+		return
+	}
+	for _, addr := range addrs {
+		rrs, _, err := transferZone(zone, addr, nil)
+		if err != nil {
+			continue
+		}
+		for _, rr := range rrs {
+			ptr, ok := rr.(*dns.PTR)
+			if !ok {
+				continue
+			}
+			label := strings.SplitN(ptr.Hdr.Name, ".", 2)[0]
+			if n, err := strconv.Atoi(label); err != nil || n < 0 || n > 255 {
+				continue
+			}
+			t.addResultSource("Reverse Classless AXFR", strings.Join(append(octets[:3:3], label), "."), strings.TrimRight(ptr.Ptr, "."), "")
+		}
+		return
+	}
+}
@@ -0,0 +1,148 @@
+package bsw
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Number of nibbles in an IPv6 address.
+const ip6Nibbles = 32
+
+// ReverseWalk6 enumerates PTR records beneath an IPv6 prefix by walking the ip6.arpa
+// tree one nibble at a time. Following RFC 8020, a NXDOMAIN response means nothing
+// exists below a name, so the branch is pruned. NOERROR means the name is an empty
+// non-terminal or a PTR owner and each of its 16 children are queried in turn.
+func ReverseWalk6(prefix, serverAddr string) *Tsk {
+	t := newTsk("Reverse IPv6 Walk")
+	defer t.keepPartial()
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		t.SetErr(err)
+		return t
+	}
+	if network.IP.To4() != nil {
+		t.SetErr(fmt.Errorf("%s is not an IPv6 network", prefix))
+		return t
+	}
+	ones, _ := network.Mask.Size()
+	nibbles := ipToNibbles(network.IP)
+
+	// Servers that do not implement RFC 8020 return NOERROR for names that do not
+	// exist, this would cause every branch of the tree to be walked.
+	if ones < 128 {
+		if err := checkNXDomainSupport(nibbles, ones, serverAddr); err != nil {
+			t.SetErr(err)
+			return t
+		}
+	}
+
+	fixed := ones / 4
+	if rem := ones % 4; rem != 0 {
+		// The prefix does not fall on a nibble boundary. Walk each possible value
+		// of the partially masked nibble.
+		base := nibbles[fixed]
+		for i := byte(0); i < 1<<uint(4-rem); i++ {
+			walkNibbles(t, append(nibbles[:fixed:fixed], base|i), serverAddr)
+		}
+		return t
+	}
+	walkNibbles(t, nibbles[:fixed:fixed], serverAddr)
+	return t
+}
+
+// walkNibbles queries the ip6.arpa name for nibbles and recurses into each child
+// that is not NXDOMAIN.
+func walkNibbles(t *Tsk, nibbles []byte, serverAddr string) {
+	rcode, answers, err := lookupRcode(nibblesToArpa(nibbles), dns.TypePTR, serverAddr)
+	if err != nil {
+		t.SetErr(err)
+		return
+	}
+	switch rcode {
+	case dns.RcodeNameError:
+		return
+	case dns.RcodeSuccess:
+	default:
+		t.SetErr(fmt.Errorf("%s: %s", nibblesToArpa(nibbles), dns.RcodeToString[rcode]))
+		return
+	}
+	if len(nibbles) == ip6Nibbles {
+		ip := nibblesToIP(nibbles)
+		for _, a := range answers {
+			if ptr, ok := a.(*dns.PTR); ok {
+				t.AddResult(ip, strings.TrimRight(ptr.Ptr, "."))
+			}
+		}
+		return
+	}
+	for i := byte(0); i < 16; i++ {
+		walkNibbles(t, append(nibbles[:len(nibbles):len(nibbles)], i), serverAddr)
+	}
+}
+
+// checkNXDomainSupport queries a random address within the network and returns an
+// error if the server does not respond with NXDOMAIN.
+func checkNXDomainSupport(nibbles []byte, ones int, serverAddr string) error {
+	probe := make([]byte, ip6Nibbles)
+	copy(probe, nibbles)
+	for i := ones / 4; i < ip6Nibbles; i++ {
+		n := byte(rand.Intn(16))
+		if i == ones/4 && ones%4 != 0 {
+			n = nibbles[i] | n&(1<<uint(4-ones%4)-1)
+		}
+		probe[i] = n
+	}
+	rcode, _, err := lookupRcode(nibblesToArpa(probe), dns.TypePTR, serverAddr)
+	if err != nil {
+		return err
+	}
+	if rcode != dns.RcodeNameError {
+		return errors.New("server did not return NXDOMAIN for a non-existent name, unable to walk ip6.arpa")
+	}
+	return nil
+}
+
+// lookupRcode returns the response code and answer section for a query.
+func lookupRcode(fqdn string, qtype uint16, serverAddr string) (int, []dns.RR, error) {
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(fqdn), qtype)
+	in, err := dns.Exchange(m, serverAddress(serverAddr))
+	if err != nil {
+		return 0, nil, err
+	}
+	return in.Rcode, in.Answer, nil
+}
+
+// ipToNibbles splits an IPv6 address into its 32 nibbles, most significant first.
+func ipToNibbles(ip net.IP) []byte {
+	ip = ip.To16()
+	nibbles := make([]byte, 0, ip6Nibbles)
+	for _, b := range ip {
+		nibbles = append(nibbles, b>>4, b&0x0f)
+	}
+	return nibbles
+}
+
+// nibblesToIP converts 32 nibbles into an IPv6 address string.
+func nibblesToIP(nibbles []byte) string {
+	ip := make(net.IP, net.IPv6len)
+	for i := range ip {
+		ip[i] = nibbles[i*2]<<4 | nibbles[i*2+1]
+	}
+	return ip.String()
+}
+
+// nibblesToArpa returns the ip6.arpa name for a list of nibbles.
+func nibblesToArpa(nibbles []byte) string {
+	labels := make([]string, 0, len(nibbles)+2)
+	for i := len(nibbles) - 1; i >= 0; i-- {
+		labels = append(labels, fmt.Sprintf("%x", nibbles[i]))
+	}
+	labels = append(labels, "ip6", "arpa.")
+	return strings.Join(labels, ".")
+}
@@ -0,0 +1,99 @@
+package bsw
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startTestDNSServer starts a DNS server on a random local UDP port and returns
+// its address.
+func startTestDNSServer(t *testing.T, handler dns.Handler) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+// ptrZone answers PTR queries for names in records, NOERROR for empty non-terminals
+// and NXDOMAIN for everything else.
+type ptrZone struct {
+	records map[string]string
+	queries int64
+}
+
+func (z *ptrZone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	atomic.AddInt64(&z.queries, 1)
+	m := &dns.Msg{}
+	m.SetReply(r)
+	name := strings.ToLower(r.Question[0].Name)
+	if target, ok := z.records[name]; ok {
+		rr, _ := dns.NewRR(name + " 300 IN PTR " + target)
+		m.Answer = append(m.Answer, rr)
+		w.WriteMsg(m)
+		return
+	}
+	m.Rcode = dns.RcodeNameError
+	for owner := range z.records {
+		if strings.HasSuffix(owner, "."+name) {
+			m.Rcode = dns.RcodeSuccess
+			break
+		}
+	}
+	w.WriteMsg(m)
+}
+
+func TestReverseWalk6(t *testing.T) {
+	zone := &ptrZone{records: map[string]string{}}
+	for ip, host := range map[string]string{
+		"2001:db8::1":        "one.example.com.",
+		"2001:db8::a:1":      "two.example.com.",
+		"2001:db8:0:1::beef": "three.example.com.",
+	} {
+		arpa, _ := dns.ReverseAddr(ip)
+		zone.records[arpa] = host
+	}
+	addr := startTestDNSServer(t, zone)
+
+	tsk := ReverseWalk6("2001:db8::/48", addr)
+	if err := tsk.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if tsk.Task() != "Reverse IPv6 Walk" {
+		t.Error("task from ReverseWalk6 was not Reverse IPv6 Walk")
+	}
+	found := map[string]string{}
+	for _, r := range tsk.Results() {
+		found[r.IP] = r.Hostname
+	}
+	if len(found) != 3 {
+		t.Errorf("expected 3 results from ReverseWalk6, got %d", len(found))
+	}
+	if found["2001:db8:0:1::beef"] != "three.example.com" {
+		t.Error("ReverseWalk6 did not find three.example.com")
+	}
+	if n := atomic.LoadInt64(&zone.queries); n > 1000 {
+		t.Errorf("ReverseWalk6 made %d queries, expected pruning", n)
+	}
+}
+
+func TestReverseWalk6NoNXDomain(t *testing.T) {
+	addr := startTestDNSServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := &dns.Msg{}
+		m.SetReply(r)
+		w.WriteMsg(m)
+	}))
+	tsk := ReverseWalk6("2001:db8::/32", addr)
+	if tsk.Err() == nil {
+		t.Error("ReverseWalk6 did not return an error for a server without NXDOMAIN support")
+	}
+}
@@ -0,0 +1,103 @@
+package bsw
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// testZone answers queries from a list of records. Records matching the
+// question name and type, or a CNAME for the name, are returned.
+type testZone []dns.RR
+
+func newTestZone(t *testing.T, records ...string) testZone {
+	z := testZone{}
+	for _, r := range records {
+		rr, err := dns.NewRR(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z = append(z, rr)
+	}
+	return z
+}
+
+func (z testZone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := &dns.Msg{}
+	m.SetReply(r)
+	q := r.Question[0]
+	m.Rcode = dns.RcodeNameError
+	for _, rr := range z {
+		if !strings.EqualFold(rr.Header().Name, q.Name) {
+			continue
+		}
+		m.Rcode = dns.RcodeSuccess
+		if rr.Header().Rrtype == q.Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+	w.WriteMsg(m)
+}
+
+func TestReverse(t *testing.T) {
+	addr := startTestDNSServer(t, newTestZone(t,
+		"1.2.0.192.in-addr.arpa. 300 IN PTR www.example.com.",
+		"2.2.0.192.in-addr.arpa. 300 IN PTR 192-0-2-2.isp.example.",
+	))
+	tsk := Reverse("192.0.2.1", addr, nil)
+	if err := tsk.Err(); err != nil {
+		t.Fatal(err)
+	}
+	results := tsk.Results()
+	if len(results) != 1 || results[0].Hostname != "www.example.com" {
+		t.Error("Reverse did not return the correct PTR")
+	}
+	tsk = Reverse("192.0.2.2", addr, nil)
+	if tsk.Err() == nil {
+		t.Error("Reverse did not filter a generic PTR")
+	}
+}
+
+func TestReverseClassless(t *testing.T) {
+	addr := startTestDNSServer(t, newTestZone(t,
+		"5.2.0.198.in-addr.arpa. 300 IN CNAME 5.0-25.2.0.198.in-addr.arpa.",
+		"5.0-25.2.0.198.in-addr.arpa. 300 IN PTR mail.customer.example.",
+		"0-25.2.0.198.in-addr.arpa. 300 IN NS ns1.customer.example.",
+		"ns1.customer.example. 300 IN A 127.0.0.2",
+	))
+	zones := NewClasslessZones()
+	tsk := Reverse("198.0.2.5", addr, zones)
+	if tsk.Task() != "Reverse" {
+		t.Errorf("Reverse renamed its task to %s", tsk.Task())
+	}
+	found := map[string]bool{}
+	for _, r := range tsk.Results() {
+		found[r.Source+" "+r.IP+" "+r.Hostname+" "+r.Info] = true
+		if strings.HasSuffix(r.Hostname, ".in-addr.arpa") {
+			t.Errorf("Reverse returned the delegated zone %s as a hostname", r.Hostname)
+		}
+	}
+	for _, want := range []string{
+		"Reverse 198.0.2.5 mail.customer.example ",
+		"Reverse Classless Delegation 127.0.0.2 ns1.customer.example nameserver of 0-25.2.0.198.in-addr.arpa",
+	} {
+		if !found[want] {
+			t.Errorf("Reverse did not return %s", want)
+		}
+	}
+	if tsk := Reverse("198.0.2.5", addr, zones); len(tsk.Results()) != 1 {
+		t.Errorf("Reverse followed a delegation that was already reported, got %v", tsk.Results())
+	}
+}
+
+func TestClasslessZone(t *testing.T) {
+	if z := classlessZone("5.2.0.192.in-addr.arpa.", []string{"5.0/25.2.0.192.in-addr.arpa"}); z != "0/25.2.0.192.in-addr.arpa" {
+		t.Errorf("classlessZone returned %s", z)
+	}
+	for _, cname := range []string{"5.2.0.192.in-addr.arpa", "host.example.com", "5.2.0.193.in-addr.arpa", "6.0/25.2.0.192.in-addr.arpa", "5.reverse.2.0.192.in-addr.arpa"} {
+		if z := classlessZone("5.2.0.192.in-addr.arpa.", []string{cname}); z != "" {
+			t.Errorf("classlessZone returned %s for %s", z, cname)
+		}
+	}
+}
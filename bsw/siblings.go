@@ -0,0 +1,114 @@
+package bsw
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// PublicSuffixes is the built-in list of top level domains and public suffixes used to
+// find sibling domains.
+var PublicSuffixes = []string{
+	"com", "net", "org", "info", "biz", "io", "co", "us", "ca", "mx", "br", "ar", "cl",
+	"uk", "co.uk", "org.uk", "ie", "de", "fr", "es", "it", "nl", "be", "lu", "ch", "at",
+	"dk", "se", "no", "fi", "is", "pl", "cz", "sk", "hu", "ro", "bg", "gr", "pt", "ru",
+	"ua", "tr", "il", "ae", "sa", "za", "co.za", "ng", "ke", "eg", "in", "co.in", "cn",
+	"com.cn", "hk", "com.hk", "tw", "com.tw", "jp", "co.jp", "kr", "co.kr", "sg",
+	"com.sg", "my", "com.my", "id", "co.id", "th", "co.th", "ph", "com.ph", "vn", "au",
+	"com.au", "net.au", "nz", "co.nz", "com.br", "com.mx", "com.ar", "eu", "asia", "app",
+	"dev", "cloud", "tech", "online", "site", "global", "group", "corp", "company", "xyz",
+	"me", "tv", "cc", "ws",
+}
+
+// Labels added to the registrable label of a domain when searching for siblings,
+// e.g. example-corp.com for example.com.
+var siblingAffixes = []string{"corp", "group", "inc", "global", "online", "hq", "intl", "cloud"}
+
+// SplitDomain returns the registrable label of domain and the public suffix following
+// it, using the longest suffix in PublicSuffixes that matches. For example,
+// www.example.co.uk returns example and co.uk. If no suffix matches, the last label is used.
+func SplitDomain(domain string) (string, string) {
+	labels := strings.Split(strings.ToLower(strings.Trim(domain, ".")), ".")
+	if len(labels) < 2 {
+		return "", ""
+	}
+	known := map[string]bool{}
+	for _, s := range PublicSuffixes {
+		known[s] = true
+	}
+	for i := 1; i < len(labels); i++ {
+		if suffix := strings.Join(labels[i:], "."); known[suffix] {
+			return labels[i-1], suffix
+		}
+	}
+	return labels[len(labels)-2], labels[len(labels)-1]
+}
+
+// SiblingDomains returns the registrable label of domain, and the label joined with
+// common words such as corp and group, beneath each of suffixes and the suffix of the
+// domain. The domain itself is not returned.
+func SiblingDomains(domain string, suffixes []string) []string {
+	label, suffix := SplitDomain(domain)
+	if label == "" {
+		return []string{}
+	}
+	labels := []string{label}
+	for _, a := range siblingAffixes {
+		labels = append(labels, label+"-"+a, label+a)
+	}
+	all := append([]string{suffix}, suffixes...)
+	candidates := []string{}
+	seen := map[string]bool{label + "." + suffix: true}
+	for _, l := range labels {
+		for _, s := range all {
+			s = strings.ToLower(strings.Trim(s, "."))
+			name := l + "." + s
+			if s == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
+
+// registeredDomain returns the nameservers of domain if it is registered, determined
+// by the presence of NS or SOA records for the domain itself.
+func registeredDomain(domain, serverAddr string) ([]string, bool) {
+	if servers, err := LookupNS(domain, serverAddr); err == nil && len(servers) > 0 {
+		return servers, true
+	}
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(domain), dns.TypeSOA)
+	in, err := dns.Exchange(m, serverAddress(serverAddr))
+	if err != nil {
+		return nil, false
+	}
+	for _, rr := range in.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, dns.Fqdn(domain)) {
+			return []string{soa.Ns}, true
+		}
+	}
+	return nil, false
+}
+
+// Sibling checks if candidate, a sibling of domain returned from SiblingDomains, is
+// registered. A registered candidate is returned as a domain with its addresses, and its
+// nameservers as info.
+func Sibling(domain, candidate, serverAddr string) *Tsk {
+	t := newTsk(TaskSiblingDomain)
+	servers, ok := registeredDomain(candidate, serverAddr)
+	if !ok {
+		t.SetErr(errors.New(candidate + ": not registered"))
+		return t
+	}
+	for i, s := range servers {
+		servers[i] = strings.TrimRight(s, ".")
+	}
+	info := "sibling of " + domain + " NS:" + strings.Join(servers, ",")
+	ips, _ := LookupName(candidate, serverAddr)
+	t.AddDomain(candidate, ips, info)
+	return t
+}
@@ -0,0 +1,53 @@
+package bsw
+
+import "testing"
+
+func TestSplitDomain(t *testing.T) {
+	for domain, expected := range map[string][2]string{
+		"example.com":       {"example", "com"},
+		"www.example.co.uk": {"example", "co.uk"},
+		"example.test":      {"example", "test"},
+		"com":               {"", ""},
+	} {
+		label, suffix := SplitDomain(domain)
+		if label != expected[0] || suffix != expected[1] {
+			t.Errorf("%s: expected %v, got %s %s", domain, expected, label, suffix)
+		}
+	}
+}
+
+func TestSiblingDomains(t *testing.T) {
+	candidates := SiblingDomains("example.com", []string{"de", "co.uk", "com"})
+	found := map[string]bool{}
+	for _, c := range candidates {
+		found[c] = true
+	}
+	for _, name := range []string{"example.de", "example.co.uk", "example-corp.com", "examplegroup.de"} {
+		if !found[name] {
+			t.Errorf("SiblingDomains did not return %s", name)
+		}
+	}
+	if found["example.com"] {
+		t.Error("SiblingDomains returned the domain itself")
+	}
+}
+
+func TestSibling(t *testing.T) {
+	addr := startTestDNSServer(t, newTestZone(t,
+		"example.de. 300 IN NS ns1.example.de.",
+		"example.de. 300 IN A 192.0.2.1",
+		"example.fr. 300 IN SOA ns1.example.fr. hostmaster.example.fr. 1 7200 3600 1209600 3600",
+	))
+	tsk := Sibling("example.com", "example.de", addr)
+	domains := tsk.Domains()
+	if tsk.HasResults() || len(domains) != 1 || len(domains[0].IPs) != 1 || domains[0].IPs[0] != "192.0.2.1" || domains[0].Info != "sibling of example.com NS:ns1.example.de" {
+		t.Errorf("unexpected domains %v, results %v", domains, tsk.Results())
+	}
+	tsk = Sibling("example.com", "example.fr", addr)
+	if domains := tsk.Domains(); len(domains) != 1 || domains[0].Name != "example.fr" || len(domains[0].IPs) != 0 {
+		t.Errorf("unexpected domains %v", domains)
+	}
+	if tsk := Sibling("example.com", "example.es", addr); len(tsk.Domains()) != 0 {
+		t.Error("Sibling returned an unregistered domain")
+	}
+}
@@ -1,35 +1,110 @@
 package bsw
 
-// SRV iterates over a list of common SRV records, returning hostname and IP results for each.
-func SRV(domain, dnsServer string) *Tsk {
-	t := newTsk("SRV")
-	srvrcdarr := [...]string{"_gc._tcp.", "_kerberos._tcp.", "_kerberos._udp.", "_ldap._tcp.",
-		"_test._tcp.", "_sips._tcp.", "_sip._udp.", "_sip._tcp.", "_aix._tcp.",
-		"_aix._tcp.", "_finger._tcp.", "_ftp._tcp.", "_http._tcp.", "_nntp._tcp.",
-		"_telnet._tcp.", "_whois._tcp.", "_h323cs._tcp.", "_h323cs._udp.",
-		"_h323be._tcp.", "_h323be._udp.", "_h323ls._tcp.", "_https._tcp.",
-		"_h323ls._udp.", "_sipinternal._tcp.", "_sipinternaltls._tcp.",
-		"_sip._tls.", "_sipfederationtls._tcp.", "_jabber._tcp.",
-		"_xmpp-server._tcp.", "_xmpp-client._tcp.", "_imap.tcp.",
-		"_certificates._tcp.", "_crls._tcp.", "_pgpkeys._tcp.",
-		"_pgprevokations._tcp.", "_cmp._tcp.", "_svcp._tcp.", "_crl._tcp.",
-		"_ocsp._tcp.", "_PKIXREP._tcp.", "_smtp._tcp.", "_hkp._tcp.",
-		"_hkps._tcp.", "_jabber._udp.", "_xmpp-server._udp.", "_xmpp-client._udp.",
-		"_jabber-client._tcp.", "_jabber-client._udp.", "_kpasswd._tcp.", "_kpasswd._udp.",
-		"_imap._tcp."}
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
 
-	for _, value := range srvrcdarr {
-		fqdn := value + domain
-		srvTarget, err := LookupSRV(fqdn, dnsServer)
-		if err != nil {
+// Matches the site label of Active Directory site specific SRV names, such as NYC in
+// _ldap._tcp.NYC._sites.dc._msdcs.example.com.
+var siteRegex = regexp.MustCompile(`(?i)_(?:tcp|udp)\.([a-z0-9][a-z0-9-]*)\._sites\.`)
+
+// SRVServices is the built-in list of common SRV service labels used by SRV.
+var SRVServices = []string{
+	"_gc._tcp.", "_kerberos._tcp.", "_kerberos._udp.", "_ldap._tcp.",
+	"_test._tcp.", "_sips._tcp.", "_sip._udp.", "_sip._tcp.", "_aix._tcp.",
+	"_finger._tcp.", "_ftp._tcp.", "_http._tcp.", "_nntp._tcp.",
+	"_telnet._tcp.", "_whois._tcp.", "_h323cs._tcp.", "_h323cs._udp.",
+	"_h323be._tcp.", "_h323be._udp.", "_h323ls._tcp.", "_https._tcp.",
+	"_h323ls._udp.", "_sipinternal._tcp.", "_sipinternaltls._tcp.",
+	"_sip._tls.", "_sipfederationtls._tcp.", "_jabber._tcp.",
+	"_xmpp-server._tcp.", "_xmpp-client._tcp.", "_imap._tcp.", "_imaps._tcp.",
+	"_pop3._tcp.", "_pop3s._tcp.", "_submission._tcp.", "_autodiscover._tcp.",
+	"_caldav._tcp.", "_caldavs._tcp.", "_carddav._tcp.", "_carddavs._tcp.",
+	"_certificates._tcp.", "_crls._tcp.", "_pgpkeys._tcp.",
+	"_pgprevokations._tcp.", "_cmp._tcp.", "_svcp._tcp.", "_crl._tcp.",
+	"_ocsp._tcp.", "_PKIXREP._tcp.", "_smtp._tcp.", "_hkp._tcp.",
+	"_hkps._tcp.", "_jabber._udp.", "_xmpp-server._udp.", "_xmpp-client._udp.",
+	"_jabber-client._tcp.", "_jabber-client._udp.", "_kpasswd._tcp.", "_kpasswd._udp.",
+	"_kerberos-master._tcp.", "_kerberos-master._udp.", "_stun._udp.", "_stun._tcp.",
+	"_turn._udp.", "_turn._tcp.", "_turns._tcp.", "_ntp._udp.", "_vlmcs._tcp.",
+	"_ldap._tcp.dc._msdcs.", "_ldap._tcp.gc._msdcs.", "_ldap._tcp.pdc._msdcs.",
+	"_kerberos._tcp.dc._msdcs.", "_gc._msdcs.",
+	"_ldap._tcp.Default-First-Site-Name._sites.dc._msdcs.",
+	"_kerberos._tcp.Default-First-Site-Name._sites.dc._msdcs.",
+	"_ldap._tcp.Default-First-Site-Name._sites.",
+	"_kerberos._tcp.Default-First-Site-Name._sites.",
+}
+
+// SiteNames returns the Active Directory site names found in names, such as SRV names
+// from a zone transfer or the info of SRV results.
+func SiteNames(names []string) []string {
+	seen := map[string]bool{}
+	sites := []string{}
+	for _, n := range names {
+		for _, m := range siteRegex.FindAllStringSubmatch(n, -1) {
+			if site := strings.ToLower(m[1]); !seen[site] {
+				seen[site] = true
+				sites = append(sites, m[1])
+			}
+		}
+	}
+	sort.Strings(sites)
+	return sites
+}
+
+// SiteServices returns the SRV service labels registered by domain controllers in each
+// of sites.
+func SiteServices(sites []string) []string {
+	services := []string{}
+	for _, site := range sites {
+		services = append(services,
+			"_ldap._tcp."+site+"._sites.dc._msdcs.",
+			"_kerberos._tcp."+site+"._sites.dc._msdcs.",
+			"_ldap._tcp."+site+"._sites.gc._msdcs.",
+			"_ldap._tcp."+site+"._sites.",
+			"_kerberos._tcp."+site+"._sites.",
+			"_gc._tcp."+site+"._sites.",
+		)
+	}
+	return services
+}
+
+// SRV iterates over a list of SRV service labels, returning hostname and IP results for
+// each target. The service name, port, priority and weight of each record are included
+// as result info.
+func SRV(domain string, services []string, dnsServer string) *Tsk {
+	t := newTsk("SRV")
+	seen := map[string]bool{}
+	for _, value := range services {
+		if !strings.HasSuffix(value, ".") {
+			value += "."
+		}
+		if seen[strings.ToLower(value)] {
 			continue
 		}
-		ips, err := LookupName(srvTarget, dnsServer)
+		seen[strings.ToLower(value)] = true
+		fqdn := value + domain
+		records, err := LookupSRV(fqdn, dnsServer)
 		if err != nil {
 			continue
 		}
-		for _, ip := range ips {
-			t.AddResult(ip, srvTarget)
+		for _, srv := range records {
+			target := strings.TrimRight(srv.Target, ".")
+			if target == "" {
+				// A target of "." means the service is decidedly not available.
+				continue
+			}
+			ips, err := LookupName(target, dnsServer)
+			if err != nil {
+				continue
+			}
+			info := fmt.Sprintf("%s port:%d priority:%d weight:%d", fqdn, srv.Port, srv.Priority, srv.Weight)
+			for _, ip := range ips {
+				t.AddResultInfo(ip, target, info)
+			}
 		}
 	}
 	return t
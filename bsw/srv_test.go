@@ -0,0 +1,53 @@
+package bsw
+
+import (
+	"testing"
+)
+
+func TestSRV(t *testing.T) {
+	addr := startTestDNSServer(t, newTestZone(t,
+		"_ldap._tcp.example.com. 300 IN SRV 0 100 389 dc1.example.com.",
+		"_ldap._tcp.example.com. 300 IN SRV 10 50 389 dc2.example.com.",
+		"_custom._tcp.example.com. 300 IN SRV 0 0 8080 app.example.com.",
+		"dc1.example.com. 300 IN A 192.0.2.1",
+		"dc2.example.com. 300 IN A 192.0.2.2",
+		"app.example.com. 300 IN A 192.0.2.3",
+	))
+	tsk := SRV("example.com", append([]string{"_custom._tcp", "_ldap._tcp"}, SRVServices...), addr)
+	if tsk.Task() != "SRV" {
+		t.Error("task from SRV was not SRV")
+	}
+	found := map[string]string{}
+	for _, r := range tsk.Results() {
+		if _, ok := found[r.Hostname]; ok {
+			t.Errorf("SRV returned duplicate result for %s", r.Hostname)
+		}
+		found[r.Hostname] = r.Info
+	}
+	if len(found) != 3 {
+		t.Errorf("expected 3 results from SRV, got %d", len(found))
+	}
+	if found["dc2.example.com"] != "_ldap._tcp.example.com port:389 priority:10 weight:50" {
+		t.Errorf("SRV returned incorrect info: %s", found["dc2.example.com"])
+	}
+	if found["app.example.com"] == "" {
+		t.Error("SRV did not search a user provided service")
+	}
+}
+
+func TestSiteNames(t *testing.T) {
+	sites := SiteNames([]string{
+		"dc1.example.com",
+		"SRV _ldap._tcp.NYC._sites.dc._msdcs.example.com",
+		"_kerberos._tcp.nyc._sites.example.com port:88 priority:0 weight:100",
+		"_ldap._tcp.London-HQ._sites.example.com",
+		"_sites.example.com",
+	})
+	if len(sites) != 2 || sites[0] != "London-HQ" || sites[1] != "NYC" {
+		t.Errorf("unexpected site names %v", sites)
+	}
+	services := SiteServices(sites)
+	if len(services) == 0 || services[0] != "_ldap._tcp.London-HQ._sites.dc._msdcs." {
+		t.Errorf("unexpected services %v", services)
+	}
+}
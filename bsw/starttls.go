@@ -0,0 +1,202 @@
+package bsw
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// starttlsProtocols negotiate an upgrade to TLS over a plain text connection. Each is
+// given the connection and the name of the server, and returns once the server is ready
+// for a TLS handshake.
+var starttlsProtocols = map[string]func(conn net.Conn, name string) error{
+	"smtp":     starttlsSMTP,
+	"imap":     starttlsIMAP,
+	"pop3":     starttlsPOP3,
+	"ftp":      starttlsFTP,
+	"ldap":     starttlsLDAP,
+	"xmpp":     starttlsXMPP,
+	"postgres": starttlsPostgres,
+}
+
+func starttlsSMTP(conn net.Conn, name string) error {
+	tp := textproto.NewConn(conn)
+	if _, _, err := tp.ReadResponse(220); err != nil {
+		return err
+	}
+	if err := tp.PrintfLine("EHLO blacksheepwall"); err != nil {
+		return err
+	}
+	if _, _, err := tp.ReadResponse(250); err != nil {
+		return err
+	}
+	if err := tp.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	_, _, err := tp.ReadResponse(220)
+	return err
+}
+
+func starttlsFTP(conn net.Conn, name string) error {
+	tp := textproto.NewConn(conn)
+	if _, _, err := tp.ReadResponse(220); err != nil {
+		return err
+	}
+	if err := tp.PrintfLine("AUTH TLS"); err != nil {
+		return err
+	}
+	_, _, err := tp.ReadResponse(234)
+	return err
+}
+
+func starttlsIMAP(conn net.Conn, name string) error {
+	tp := textproto.NewConn(conn)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "* OK") {
+		return fmt.Errorf("unexpected greeting %q", line)
+	}
+	if err := tp.PrintfLine("a001 STARTTLS"); err != nil {
+		return err
+	}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a001 ") {
+			if !strings.HasPrefix(line, "a001 OK") {
+				return fmt.Errorf("unexpected response %q", line)
+			}
+			return nil
+		}
+	}
+}
+
+func starttlsPOP3(conn net.Conn, name string) error {
+	tp := textproto.NewConn(conn)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("unexpected greeting %q", line)
+	}
+	if err := tp.PrintfLine("STLS"); err != nil {
+		return err
+	}
+	if line, err = tp.ReadLine(); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("unexpected response %q", line)
+	}
+	return nil
+}
+
+// The LDAP StartTLS extended request, message ID 1, with OID 1.3.6.1.4.1.1466.20037.
+var ldapStartTLS = append([]byte{0x30, 0x1d, 0x02, 0x01, 0x01, 0x77, 0x18, 0x80, 0x16},
+	[]byte("1.3.6.1.4.1.1466.20037")...)
+
+func starttlsLDAP(conn net.Conn, name string) error {
+	if _, err := conn.Write(ldapStartTLS); err != nil {
+		return err
+	}
+	// Read the extended response, which is a sequence whose length may use the long form.
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return err
+	}
+	if hdr[0] != 0x30 {
+		return errors.New("unexpected LDAP response")
+	}
+	length := int(hdr[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return errors.New("invalid LDAP response length")
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return err
+		}
+		length = 0
+		for _, c := range b {
+			length = length<<8 | int(c)
+		}
+	}
+	if length > 4096 {
+		return errors.New("LDAP response too large")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return err
+	}
+	// The result code is the first element of the extended response (application 24).
+	i := bytes.IndexByte(body, 0x78)
+	if i == -1 {
+		return errors.New("unexpected LDAP response")
+	}
+	if r := bytes.Index(body[i:], []byte{0x0a, 0x01}); r == -1 || i+r+2 >= len(body) || body[i+r+2] != 0 {
+		return errors.New("LDAP server refused StartTLS")
+	}
+	return nil
+}
+
+func starttlsXMPP(conn net.Conn, name string) error {
+	r := bufio.NewReader(conn)
+	if _, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' to='%s' version='1.0'>", name); err != nil {
+		return err
+	}
+	if err := readUntil(r, "</stream:features>"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+	return readUntil(r, "<proceed")
+}
+
+// readUntil reads from r until s is found.
+func readUntil(r *bufio.Reader, s string) error {
+	buf := []byte{}
+	for len(buf) < 65536 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		buf = append(buf, b)
+		if bytes.HasSuffix(buf, []byte(s)) {
+			return nil
+		}
+		if bytes.HasSuffix(buf, []byte("<failure")) || bytes.HasSuffix(buf, []byte("</stream:stream>")) {
+			return errors.New("XMPP server refused STARTTLS")
+		}
+	}
+	return errors.New("XMPP response too large")
+}
+
+func starttlsPostgres(conn net.Conn, name string) error {
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], 80877103)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	resp := make([]byte, 1)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[0] != 'S' {
+		return errors.New("PostgreSQL server does not support TLS")
+	}
+	return nil
+}
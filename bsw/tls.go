@@ -1,35 +1,243 @@
 package bsw
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-// TLS attempts connection to an IP using TLS on port 443, and if successfull, will parse the server
-// certificate for CommonName and SubjectAlt names.
-func TLS(ip string, timeout int64) *Tsk {
+// TLSPort is a port to retrieve a certificate from, and the protocol used to negotiate
+// TLS on it. A protocol of tls is used for services that speak TLS immediately.
+type TLSPort struct {
+	Port     int
+	Protocol string
+}
+
+// Protocols used for ports that are not given one explicitly. All other ports use tls.
+var starttlsPorts = map[int]string{
+	21:   "ftp",
+	25:   "smtp",
+	110:  "pop3",
+	143:  "imap",
+	389:  "ldap",
+	587:  "smtp",
+	2525: "smtp",
+	5222: "xmpp",
+	5432: "postgres",
+}
+
+// DefaultTLSPorts is used by TLS when no ports are provided.
+var DefaultTLSPorts = []TLSPort{{Port: 443, Protocol: "tls"}}
+
+// ParseTLSPorts parses a comma separated list of ports, each of which may include a
+// protocol, e.g. 443,8443,25,2526/smtp. Ports without a protocol use STARTTLS if they
+// are the standard port for a supported protocol, and tls otherwise.
+func ParseTLSPorts(list string) ([]TLSPort, error) {
+	ports := []TLSPort{}
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		parts := strings.SplitN(p, "/", 2)
+		port, err := strconv.Atoi(parts[0])
+		if err != nil || port < 1 || port > 65535 {
+			return ports, fmt.Errorf("invalid port %s", parts[0])
+		}
+		protocol, ok := starttlsPorts[port]
+		if !ok {
+			protocol = "tls"
+		}
+		if len(parts) == 2 {
+			protocol = strings.ToLower(parts[1])
+			if _, ok := starttlsProtocols[protocol]; !ok && protocol != "tls" {
+				return ports, fmt.Errorf("unsupported protocol %s", parts[1])
+			}
+		}
+		ports = append(ports, TLSPort{Port: port, Protocol: protocol})
+	}
+	if len(ports) == 0 {
+		return ports, fmt.Errorf("no ports provided")
+	}
+	return ports, nil
+}
+
+// TLS attempts a TLS connection to an IP or hostname on each of ports, negotiating
+// STARTTLS when required by the port's protocol. Hostnames are sent using SNI. If
+// successfull, the server certificate is parsed for CommonName and SubjectAlt names,
+// which are returned with the address that was connected to. If ports is empty,
+// DefaultTLSPorts is used.
+func TLS(target string, ports []TLSPort, timeout int64) *Tsk {
 	t := newTsk("TLS Certificate")
-	tconn, err := net.DialTimeout("tcp", ip+":443", time.Duration(timeout)*time.Millisecond)
+	defer t.keepPartial()
+	if len(ports) == 0 {
+		ports = DefaultTLSPorts
+	}
+	serverName := ""
+	if host, isIP := probeTarget(target); !isIP {
+		serverName = host
+	}
+	for _, p := range ports {
+		state, ip, err := tlsHandshake(target, p, tlsConfig(serverName), timeout)
+		if err != nil {
+			t.SetErr(fmt.Errorf("%s port %d: %v", target, p.Port, err))
+			continue
+		}
+		cert := state.PeerCertificates[0]
+		info := NewCertificate(state.PeerCertificates)
+		info.port = p
+		if cert.Subject.CommonName != "" {
+			t.AddResultCert(ip, cert.Subject.CommonName, info)
+		}
+		for _, name := range cert.DNSNames {
+			t.AddResultCert(ip, name, info)
+		}
+	}
+	return t
+}
+
+// tlsConfig returns a configuration that does not verify certificates, sending serverName
+// using SNI if it is not empty.
+func tlsConfig(serverName string) *tls.Config {
+	return &tls.Config{InsecureSkipVerify: true, ServerName: serverName}
+}
+
+// tlsHandshake connects to an IP or hostname on a port, negotiates STARTTLS if needed and
+// performs a TLS handshake using config. The connection state and the IP address connected
+// to are returned.
+func tlsHandshake(target string, p TLSPort, config *tls.Config, timeout int64) (*tls.ConnectionState, string, error) {
+	host, _ := probeTarget(target)
+	tconn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(p.Port)), time.Duration(timeout)*time.Millisecond)
 	if err != nil {
-		t.SetErr(err)
-		return t
+		return nil, "", err
 	}
+	defer tconn.Close()
 	if err := tconn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Millisecond)); err != nil {
-		t.SetErr(err)
-		return t
+		return nil, "", err
+	}
+	if negotiate, ok := starttlsProtocols[p.Protocol]; ok {
+		name := config.ServerName
+		if name == "" {
+			name = host
+		}
+		if err := negotiate(tconn, name); err != nil {
+			return nil, "", fmt.Errorf("%s STARTTLS: %v", p.Protocol, err)
+		}
 	}
-	conn := tls.Client(tconn, &tls.Config{InsecureSkipVerify: true})
-	defer conn.Close()
+	conn := tls.Client(tconn, config)
 	if err := conn.Handshake(); err != nil {
-		t.SetErr(err)
-		return t
+		return nil, "", err
 	}
 	state := conn.ConnectionState()
-	cert := state.PeerCertificates[0]
-	t.AddResult(ip, cert.Subject.CommonName)
-	for _, name := range cert.DNSNames {
-		t.AddResult(ip, name)
+	if len(state.PeerCertificates) == 0 {
+		return nil, "", fmt.Errorf("no certificate returned")
+	}
+	return &state, remoteIP(tconn), nil
+}
+
+// DefaultSNIMax is the default maximum number of handshakes made with SNI, counted as
+// names multiplied by IPs.
+const DefaultSNIMax = 100000
+
+// SNIBaselines holds the fingerprints of the certificates returned without SNI during a
+// run, keyed by IP and port, so that each is only requested once. Servers that fail the
+// handshake without SNI have no default certificate and are stored with a zero
+// fingerprint.
+type SNIBaselines struct {
+	mu    sync.Mutex
+	certs map[string][sha256.Size]byte
+}
+
+// NewSNIBaselines returns an empty SNIBaselines.
+func NewSNIBaselines() *SNIBaselines {
+	return &SNIBaselines{certs: map[string][sha256.Size]byte{}}
+}
+
+// load returns the fingerprint stored for key and whether one was stored. A nil
+// SNIBaselines never has a fingerprint.
+func (b *SNIBaselines) load(key string) ([sha256.Size]byte, bool) {
+	if b == nil {
+		return [sha256.Size]byte{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f, ok := b.certs[key]
+	return f, ok
+}
+
+// store records the fingerprint for key.
+func (b *SNIBaselines) store(key string, f [sha256.Size]byte) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.certs[key] = f
+}
+
+// SNI performs a TLS handshake with ip on each of ports using name for SNI. If the
+// certificate returned is valid for name and is different from the certificate returned
+// without SNI, name is a virtual host served from ip and is returned as a result. If ports
+// is empty, DefaultTLSPorts is used. The certificates returned without SNI are shared
+// through baselines, which may be nil.
+func SNI(ip, name string, ports []TLSPort, baselines *SNIBaselines, timeout int64) *Tsk {
+	t := newTsk("TLS SNI")
+	defer t.keepPartial()
+	ip, _ = probeTarget(ip)
+	if len(ports) == 0 {
+		ports = DefaultTLSPorts
+	}
+	for _, p := range ports {
+		key := net.JoinHostPort(ip, strconv.Itoa(p.Port))
+		baseline, ok := baselines.load(key)
+		if !ok {
+			state, _, err := tlsHandshake(ip, p, tlsConfig(""), timeout)
+			switch {
+			case err == nil:
+				baseline = sha256.Sum256(state.PeerCertificates[0].Raw)
+			case isDialError(err):
+				// Without a baseline any certificate would look like a virtual host, so
+				// the port is skipped and the connection is retried with the next name.
+				t.SetErr(fmt.Errorf("%s port %d: %v", ip, p.Port, err))
+				continue
+			}
+			// A server that responded but refused the handshake has no default
+			// certificate, and is stored with a zero fingerprint.
+			baselines.store(key, baseline)
+		}
+		state, _, err := tlsHandshake(ip, p, tlsConfig(name), timeout)
+		if err != nil {
+			t.SetErr(fmt.Errorf("%s port %d: %v", ip, p.Port, err))
+			continue
+		}
+		cert := state.PeerCertificates[0]
+		if sha256.Sum256(cert.Raw) == baseline {
+			continue
+		}
+		if err := cert.VerifyHostname(name); err != nil {
+			continue
+		}
+		info := NewCertificate(state.PeerCertificates)
+		info.port = p
+		t.AddResultCert(ip, name, info)
+		return t
 	}
 	return t
 }
+
+// isDialError returns true if err is a failure to connect or a timeout, rather than a
+// response from the server.
+func isDialError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,306 @@
+package bsw
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate for names, using the first as the
+// CommonName.
+func testCertificate(t *testing.T, names ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0], Organization: []string{"Example Org"}},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+// startTestTLSServer listens on network and address, calling negotiate on each connection
+// before a TLS handshake using config. The port is returned.
+func startTestTLSServer(t *testing.T, network, address string, config *tls.Config, negotiate func(net.Conn, *bufio.Reader) bool) int {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Skipf("unable to listen on %s: %v", address, err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				if negotiate != nil && !negotiate(conn, bufio.NewReader(conn)) {
+					return
+				}
+				tconn := tls.Server(conn, config)
+				if err := tconn.Handshake(); err != nil {
+					return
+				}
+				io.Copy(io.Discard, tconn)
+			}(conn)
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestParseTLSPorts(t *testing.T) {
+	ports, err := ParseTLSPorts("443, 25,2526/SMTP,5432")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TLSPort{{443, "tls"}, {25, "smtp"}, {2526, "smtp"}, {5432, "postgres"}}
+	if len(ports) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, ports)
+	}
+	for i := range ports {
+		if ports[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], ports[i])
+		}
+	}
+	for _, bad := range []string{"", "https", "0", "70000", "25/gopher"} {
+		if _, err := ParseTLSPorts(bad); err == nil {
+			t.Errorf("ParseTLSPorts did not return an error for %q", bad)
+		}
+	}
+}
+
+func TestTLSStartTLS(t *testing.T) {
+	config := &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "mail.example.com", "smtp.example.com")}}
+	expect := func(r *bufio.Reader, prefix string) bool {
+		line, err := r.ReadString('\n')
+		return err == nil && strings.HasPrefix(line, prefix)
+	}
+	servers := map[string]func(net.Conn, *bufio.Reader) bool{
+		"tls": nil,
+		"smtp": func(c net.Conn, r *bufio.Reader) bool {
+			io.WriteString(c, "220 mail.example.com ESMTP\r\n")
+			if !expect(r, "EHLO") {
+				return false
+			}
+			io.WriteString(c, "250-mail.example.com\r\n250 STARTTLS\r\n")
+			if !expect(r, "STARTTLS") {
+				return false
+			}
+			io.WriteString(c, "220 ready\r\n")
+			return true
+		},
+		"imap": func(c net.Conn, r *bufio.Reader) bool {
+			io.WriteString(c, "* OK IMAP4rev1 ready\r\n")
+			if !expect(r, "a001 STARTTLS") {
+				return false
+			}
+			io.WriteString(c, "a001 OK begin TLS\r\n")
+			return true
+		},
+		"pop3": func(c net.Conn, r *bufio.Reader) bool {
+			io.WriteString(c, "+OK POP3 ready\r\n")
+			if !expect(r, "STLS") {
+				return false
+			}
+			io.WriteString(c, "+OK begin TLS\r\n")
+			return true
+		},
+		"ftp": func(c net.Conn, r *bufio.Reader) bool {
+			io.WriteString(c, "220 FTP ready\r\n")
+			if !expect(r, "AUTH TLS") {
+				return false
+			}
+			io.WriteString(c, "234 AUTH TLS successful\r\n")
+			return true
+		},
+		"ldap": func(c net.Conn, r *bufio.Reader) bool {
+			req := make([]byte, len(ldapStartTLS))
+			if _, err := io.ReadFull(r, req); err != nil || !bytes.Equal(req, ldapStartTLS) {
+				return false
+			}
+			// An extended response with a success result code, using the long form length.
+			c.Write([]byte{0x30, 0x81, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+			return true
+		},
+		"xmpp": func(c net.Conn, r *bufio.Reader) bool {
+			if readUntil(r, "to='127.0.0.1' version='1.0'>") != nil {
+				return false
+			}
+			io.WriteString(c, "<?xml version='1.0'?><stream:stream xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>")
+			io.WriteString(c, "<stream:features><starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>")
+			if readUntil(r, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>") != nil {
+				return false
+			}
+			io.WriteString(c, "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+			return true
+		},
+		"postgres": func(c net.Conn, r *bufio.Reader) bool {
+			if _, err := io.ReadFull(r, make([]byte, 8)); err != nil {
+				return false
+			}
+			c.Write([]byte("S"))
+			return true
+		},
+	}
+	for protocol, negotiate := range servers {
+		port := startTestTLSServer(t, "tcp", "127.0.0.1:0", config, negotiate)
+		ports, err := ParseTLSPorts(strconv.Itoa(port) + "/" + protocol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tsk := TLS("127.0.0.1", ports, 2000)
+		found := map[string]bool{}
+		for _, r := range tsk.Results() {
+			found[r.Hostname] = true
+		}
+		if !found["mail.example.com"] || !found["smtp.example.com"] {
+			t.Errorf("%s: TLS did not return certificate names, errors: %v", protocol, tsk.Err())
+		}
+	}
+}
+
+func TestStartTLSRefused(t *testing.T) {
+	servers := map[string]func(net.Conn){
+		"ftp": func(c net.Conn) {
+			io.WriteString(c, "220 FTP ready\r\n")
+			bufio.NewReader(c).ReadString('\n')
+			io.WriteString(c, "530 Please login with USER and PASS\r\n")
+		},
+		"ldap": func(c net.Conn) {
+			io.ReadFull(c, make([]byte, len(ldapStartTLS)))
+			// An extended response with the protocolError result code.
+			c.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x02, 0x04, 0x00, 0x04, 0x00})
+		},
+		"xmpp": func(c net.Conn) {
+			r := bufio.NewReader(c)
+			readUntil(r, "version='1.0'>")
+			io.WriteString(c, "<stream:stream version='1.0'><stream:features></stream:features>")
+			readUntil(r, "/>")
+			io.WriteString(c, "<failure xmlns='urn:ietf:params:xml:ns:xmpp-tls'/></stream:stream>")
+		},
+	}
+	for protocol, serve := range servers {
+		client, server := net.Pipe()
+		client.SetDeadline(time.Now().Add(5 * time.Second))
+		go func(serve func(net.Conn)) {
+			defer server.Close()
+			serve(server)
+		}(serve)
+		if err := starttlsProtocols[protocol](client, "example.com"); err == nil {
+			t.Errorf("%s: StartTLS did not return an error when refused", protocol)
+		}
+		client.Close()
+	}
+}
+
+func TestSNI(t *testing.T) {
+	defaultCert := testCertificate(t, "default.example.net")
+	vhostCert := testCertificate(t, "shop.example.com")
+	config := &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName == "shop.example.com" || hello.ServerName == "other.example.com" {
+				return &vhostCert, nil
+			}
+			return &defaultCert, nil
+		},
+	}
+	port := startTestTLSServer(t, "tcp", "127.0.0.1:0", config, nil)
+	ports := []TLSPort{{Port: port, Protocol: "tls"}}
+	baselines := NewSNIBaselines()
+	if tsk := SNI("127.0.0.1", "shop.example.com", ports, baselines, 2000); !tsk.HasResults() {
+		t.Errorf("SNI did not return a virtual host, errors: %v", tsk.Err())
+	}
+	for _, name := range []string{"default.example.net", "www.example.com", "other.example.com"} {
+		if tsk := SNI("127.0.0.1", name, ports, baselines, 2000); tsk.HasResults() {
+			t.Errorf("SNI returned %s, which does not have its own certificate", name)
+		}
+	}
+}
+
+func TestSNIWithoutDefaultCertificate(t *testing.T) {
+	vhostCert := testCertificate(t, "shop.example.com")
+	config := &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName == "shop.example.com" {
+				return &vhostCert, nil
+			}
+			return nil, errors.New("unknown server name")
+		},
+	}
+	port := startTestTLSServer(t, "tcp", "127.0.0.1:0", config, nil)
+	ports := []TLSPort{{Port: port, Protocol: "tls"}}
+	for _, name := range []string{"www.example.com", "shop.example.com"} {
+		tsk := SNI("127.0.0.1", name, ports, nil, 2000)
+		if tsk.HasResults() != (name == "shop.example.com") {
+			t.Errorf("SNI returned %v for %s on a server without a default certificate, errors: %v", tsk.HasResults(), name, tsk.Err())
+		}
+	}
+}
+
+func TestSNIUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	baselines := NewSNIBaselines()
+	tsk := SNI("127.0.0.1", "shop.example.com", []TLSPort{{Port: port, Protocol: "tls"}}, baselines, 2000)
+	if tsk.HasResults() || tsk.Err() == nil {
+		t.Errorf("SNI did not return an error for a closed port, results: %v", tsk.Results())
+	}
+	if _, ok := baselines.load(net.JoinHostPort("127.0.0.1", strconv.Itoa(port))); ok {
+		t.Error("SNI stored a baseline for a port it could not connect to")
+	}
+}
+
+func TestTLSTargets(t *testing.T) {
+	var serverName string
+	cert := testCertificate(t, "www.example.com")
+	config := &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			serverName = hello.ServerName
+			return &cert, nil
+		},
+	}
+	for target, address := range map[string]string{"::1": "[::1]:0", "localhost": "127.0.0.1:0"} {
+		t.Run(target, func(t *testing.T) {
+			port := startTestTLSServer(t, "tcp", address, config, nil)
+			serverName = ""
+			results := TLS(target, []TLSPort{{Port: port, Protocol: "tls"}}, 2000).Results()
+			if len(results) == 0 || results[0].Hostname != "www.example.com" || net.ParseIP(results[0].IP) == nil {
+				t.Fatalf("unexpected results %v", results)
+			}
+			if target == "localhost" && serverName != "localhost" {
+				t.Errorf("TLS did not send the hostname using SNI, got %q", serverName)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package bsw
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Matches a label that may be registered.
+var labelRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9\-]*[a-z0-9])?$`)
+
+// Characters that look like other characters in ASCII, and sequences of characters
+// that look like a single character.
+var asciiHomoglyphs = map[string][]string{
+	"o": {"0"}, "0": {"o"}, "l": {"1", "i"}, "i": {"1", "l"}, "1": {"l", "i"},
+	"m": {"rn", "nn"}, "rn": {"m"}, "w": {"vv"}, "vv": {"w"}, "d": {"cl"}, "cl": {"d"},
+	"g": {"q"}, "q": {"g"}, "u": {"v"}, "v": {"u"}, "s": {"5"}, "5": {"s"}, "b": {"6"},
+}
+
+// Unicode characters that are indistinguishable from ASCII characters in most fonts.
+var idnHomoglyphs = map[rune][]rune{
+	'a': {'а', 'à', 'á'}, 'c': {'с'}, 'e': {'е', 'é'}, 'i': {'і', 'í'}, 'j': {'ј'},
+	'o': {'о', 'ö', 'ó'}, 'p': {'р'}, 's': {'ѕ'}, 'u': {'ü', 'ú'}, 'x': {'х'}, 'y': {'у'},
+}
+
+// Lookalike is a domain that could be mistaken for another.
+type Lookalike struct {
+	Name string
+	Kind string
+}
+
+// Typosquats returns lookalikes of domain generated from its registrable label by omitting,
+// transposing, bit flipping and hyphenating characters, replacing characters with ASCII
+// and IDN homoglyphs, and swapping the public suffix for each of suffixes. IDN names are
+// returned in their ASCII (punycode) form.
+func Typosquats(domain string, suffixes []string) []Lookalike {
+	label, suffix := SplitDomain(domain)
+	if label == "" {
+		return []Lookalike{}
+	}
+	lookalikes := []Lookalike{}
+	seen := map[string]bool{label: true}
+	add := func(kind, l string) {
+		if seen[l] || !labelRegex.MatchString(l) {
+			return
+		}
+		seen[l] = true
+		lookalikes = append(lookalikes, Lookalike{Name: l + "." + suffix, Kind: kind})
+	}
+
+	for i := range label {
+		add("omission", label[:i]+label[i+1:])
+	}
+	for i := 0; i < len(label)-1; i++ {
+		add("transposition", label[:i]+string(label[i+1])+string(label[i])+label[i+2:])
+	}
+	for i := 1; i < len(label); i++ {
+		add("hyphenation", label[:i]+"-"+label[i:])
+	}
+	for i := range label {
+		for bit := uint(0); bit < 8; bit++ {
+			c := label[i] ^ (1 << bit)
+			if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' {
+				add("bitflip", label[:i]+string(c)+label[i+1:])
+			}
+		}
+	}
+	froms := []string{}
+	for from := range asciiHomoglyphs {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for _, from := range froms {
+		for i := 0; i+len(from) <= len(label); i++ {
+			if label[i:i+len(from)] != from {
+				continue
+			}
+			for _, to := range asciiHomoglyphs[from] {
+				add("homoglyph", label[:i]+to+label[i+len(from):])
+			}
+		}
+	}
+	runes := []rune(label)
+	for i, r := range runes {
+		for _, h := range idnHomoglyphs[r] {
+			replaced := append(append(append([]rune{}, runes[:i]...), h), runes[i+1:]...)
+			if ascii, err := idna.ToASCII(string(replaced)); err == nil {
+				add("idn homoglyph", ascii)
+			}
+		}
+	}
+
+	// Swapping the suffix keeps the label, so it is not checked against seen labels.
+	swapped := map[string]bool{label + "." + suffix: true}
+	for _, s := range suffixes {
+		name := label + "." + strings.ToLower(strings.Trim(s, "."))
+		if strings.HasSuffix(name, ".") || swapped[name] {
+			continue
+		}
+		swapped[name] = true
+		lookalikes = append(lookalikes, Lookalike{Name: name, Kind: "tld swap"})
+	}
+	return lookalikes
+}
+
+// Typosquat checks if a lookalike of domain is registered. A registered lookalike is
+// returned as a domain with its addresses, and the kind of lookalike and its MX and NS
+// records as info.
+func Typosquat(domain string, lookalike Lookalike, serverAddr string) *Tsk {
+	t := newTsk("Typosquat")
+	servers, ok := registeredDomain(lookalike.Name, serverAddr)
+	if !ok {
+		t.SetErr(errors.New(lookalike.Name + ": not registered"))
+		return t
+	}
+	for i, s := range servers {
+		servers[i] = strings.TrimRight(s, ".")
+	}
+	info := lookalike.Kind + " lookalike of " + domain + " NS:" + strings.Join(servers, ",")
+	if mx, err := LookupMX(lookalike.Name, serverAddr); err == nil && len(mx) > 0 {
+		for i, m := range mx {
+			mx[i] = strings.TrimRight(m, ".")
+		}
+		info += " MX:" + strings.Join(mx, ",")
+	}
+	ips, _ := LookupName(lookalike.Name, serverAddr)
+	t.AddDomain(lookalike.Name, ips, info)
+	return t
+}
@@ -0,0 +1,53 @@
+package bsw
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTyposquats(t *testing.T) {
+	kinds := map[string]string{}
+	for _, l := range Typosquats("www.google.com", []string{"de", "com"}) {
+		if _, ok := kinds[l.Name]; ok {
+			t.Errorf("Typosquats returned %s more than once", l.Name)
+		}
+		kinds[l.Name] = l.Kind
+	}
+	for name, kind := range map[string]string{
+		"gogle.com":         "omission",
+		"googel.com":        "transposition",
+		"goo-gle.com":       "hyphenation",
+		"foogle.com":        "bitflip",
+		"g0ogle.com":        "homoglyph",
+		"google.de":         "tld swap",
+		"xn--gogle-jye.com": "idn homoglyph",
+	} {
+		if kinds[name] != kind {
+			t.Errorf("expected %s to be a %s lookalike, got %q", name, kind, kinds[name])
+		}
+	}
+	for name := range kinds {
+		if name == "google.com" || strings.HasPrefix(name, "-") || strings.Contains(name, "-.") {
+			t.Errorf("Typosquats returned an invalid lookalike %s", name)
+		}
+	}
+}
+
+func TestTyposquat(t *testing.T) {
+	addr := startTestDNSServer(t, newTestZone(t,
+		"gogle.com. 300 IN NS ns1.parking.example.",
+		"gogle.com. 300 IN MX 10 mail.parking.example.",
+		"gogle.com. 300 IN A 192.0.2.5",
+	))
+	tsk := Typosquat("google.com", Lookalike{Name: "gogle.com", Kind: "omission"}, addr)
+	domains := tsk.Domains()
+	if tsk.HasResults() || len(domains) != 1 || len(domains[0].IPs) != 1 || domains[0].IPs[0] != "192.0.2.5" {
+		t.Fatalf("unexpected domains %v, results %v", domains, tsk.Results())
+	}
+	if domains[0].Info != "omission lookalike of google.com NS:ns1.parking.example MX:mail.parking.example" {
+		t.Errorf("unexpected info %s", domains[0].Info)
+	}
+	if tsk := Typosquat("google.com", Lookalike{Name: "googel.com", Kind: "transposition"}, addr); len(tsk.Domains()) != 0 {
+		t.Error("Typosquat returned an unregistered lookalike")
+	}
+}
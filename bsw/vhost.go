@@ -0,0 +1,58 @@
+package bsw
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultVHostMax is the default maximum number of requests made with VHost.
+const DefaultVHostMax = 100000
+
+// VHost requests / from ip over http and https using hostname as the Host header and TLS
+// server name, and compares each response with the response for a random name beneath the
+// same domain. If any response differs by status, length, title or body, or the server
+// refuses to respond to the random name, hostname is a virtual host served from ip and is
+// returned as a result. The protocol, status and title of each distinct response are
+// returned as result info. The responses for random names are shared through baselines,
+// which may be nil. Servers that refuse a random name have no default site and are stored
+// with a nil response.
+func VHost(ip, hostname string, baselines *HTTPBaselines, timeout int64) *Tsk {
+	t := newTsk("HTTP VHost")
+	domain := parentDomain(hostname)
+	if domain == "" {
+		domain = hostname
+	}
+	responded := 0
+	distinct := []string{}
+	for _, proto := range []string{"http", "https"} {
+		key := proto + " " + ip + " " + domain
+		baseline, ok := baselines.load(key)
+		if !ok {
+			b, err := fetchPage(proto, ip, randomLabel()+"."+domain, timeout)
+			if err != nil && isDialError(err) {
+				// Without a baseline any response would look like a virtual host, so the
+				// protocol is skipped and the connection is retried with the next name.
+				continue
+			}
+			baseline = b
+			baselines.store(key, baseline)
+		}
+		page, err := fetchPage(proto, ip, hostname, timeout)
+		if err != nil {
+			continue
+		}
+		responded++
+		if baseline == nil || !page.similar(baseline) {
+			distinct = append(distinct, strings.TrimSpace(fmt.Sprintf("%s %d %s", proto, page.status, page.title)))
+		}
+	}
+	if responded == 0 {
+		t.SetErr(errors.New(ip + " " + hostname + ": no HTTP response"))
+		return t
+	}
+	if len(distinct) > 0 {
+		t.AddResultInfo(ip, hostname, strings.Join(distinct, ", "))
+	}
+	return t
+}
@@ -0,0 +1,80 @@
+package bsw
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVHost(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Host, "admin.example.com") {
+			fmt.Fprint(w, "<html><title>Admin Login</title><form>username password</form></html>")
+			return
+		}
+		fmt.Fprintf(w, "<html><title>Welcome</title>Default page for %s</html>", r.Host)
+	}))
+	defer ts.Close()
+	ip := strings.TrimPrefix(ts.URL, "http://")
+
+	baselines := NewHTTPBaselines()
+	tsk := VHost(ip, "admin.example.com", baselines, 2000)
+	results := tsk.Results()
+	if len(results) != 1 || results[0].Hostname != "admin.example.com" || results[0].IP != ip {
+		t.Fatalf("VHost did not return a virtual host, got %v, errors: %v", results, tsk.Err())
+	}
+	if results[0].Info != "http 200 admin login" {
+		t.Errorf("unexpected info %q", results[0].Info)
+	}
+	if tsk := VHost(ip, "www.example.com", baselines, 2000); tsk.HasResults() {
+		t.Errorf("VHost returned %v, which serves the default page", tsk.Results())
+	}
+}
+
+func TestVHostWithoutDefaultSite(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Host, "intranet.example.com") {
+			fmt.Fprint(w, "<html><title>Intranet</title></html>")
+			return
+		}
+		// Close the connection without a response for unknown names.
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer ts.Close()
+	ip := strings.TrimPrefix(ts.URL, "http://")
+
+	tsk := VHost(ip, "intranet.example.com", nil, 2000)
+	if results := tsk.Results(); len(results) != 1 || results[0].Hostname != "intranet.example.com" {
+		t.Errorf("VHost did not return a virtual host on a server without a default site, got %v, errors: %v", results, tsk.Err())
+	}
+}
+
+func TestVHostBaselineTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Host, "app.example.com") {
+			// Stall on random names until the client gives up.
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		fmt.Fprint(w, "<html><title>App</title></html>")
+	}))
+	defer ts.Close()
+	ip := strings.TrimPrefix(ts.URL, "http://")
+
+	baselines := NewHTTPBaselines()
+	if tsk := VHost(ip, "app.example.com", baselines, 300); tsk.HasResults() {
+		t.Errorf("VHost returned %v without a baseline response", tsk.Results())
+	}
+	if _, ok := baselines.load("http " + ip + " example.com"); ok {
+		t.Error("VHost stored a baseline after a timeout")
+	}
+}
@@ -0,0 +1,204 @@
+package bsw
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// TTL used for records written by WriteZone.
+const zoneTTL = 3600
+
+// Matches names that may be written to a zone file, including wildcards.
+var zoneNameRegex = regexp.MustCompile(`^(\*\.)?([a-z0-9_]([a-z0-9_\-]*[a-z0-9_])?\.)+$`)
+
+// ParseZoneFile parses a BIND format zone file and returns every record. Origin is
+// used for relative names when the file does not contain an $ORIGIN directive.
+func ParseZoneFile(path, origin string) ([]dns.RR, error) {
+	records := []dns.RR{}
+	f, err := os.Open(path)
+	if err != nil {
+		return records, err
+	}
+	defer f.Close()
+	if origin != "" {
+		origin = dns.Fqdn(origin)
+	}
+	zp := dns.NewZoneParser(f, origin, path)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		records = append(records, rr)
+	}
+	return records, zp.Err()
+}
+
+// ZoneAddresses returns every address from A and AAAA records.
+func ZoneAddresses(records []dns.RR) []string {
+	ips := []string{}
+	for _, rr := range records {
+		switch v := rr.(type) {
+		case *dns.A:
+			ips = append(ips, v.A.String())
+		case *dns.AAAA:
+			ips = append(ips, v.AAAA.String())
+		}
+	}
+	return removeDuplicates(ips)
+}
+
+// ZoneRecords returns results for every hostname found in a list of records, such as
+// those returned from ParseZoneFile. Names outside of the records are resolved
+// using serverAddr.
+func ZoneRecords(records []dns.RR, serverAddr string) *Tsk {
+	t := newTsk("zone file")
+	addZoneRecords(t, records, serverAddr)
+	return t
+}
+
+// ZoneOrigin returns the longest domain that every valid hostname in results is within,
+// or an empty string if they only share a top level domain.
+func ZoneOrigin(results Results) string {
+	var common []string
+	for _, r := range results {
+		name := strings.ToLower(dns.Fqdn(r.Hostname))
+		if !zoneNameRegex.MatchString(name) {
+			continue
+		}
+		labels := dns.SplitDomainName(strings.TrimPrefix(name, "*."))
+		if common == nil {
+			common = labels
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(labels) && common[len(common)-1-n] == labels[len(labels)-1-n] {
+			n++
+		}
+		common = common[len(common)-n:]
+	}
+	if len(common) < 2 {
+		return ""
+	}
+	return dns.Fqdn(strings.Join(common, "."))
+}
+
+// WriteZone writes results to w as a BIND format zone file for origin, beginning with
+// $ORIGIN and the SOA and NS records of the zone. If origin is empty, ZoneOrigin is used.
+// The SOA and NS records are taken from apex, such as the records of a zone file, and a
+// SOA and NS are synthesized when apex does not contain them. Results with a CNAME info
+// are written as CNAME records, all others are written as A or AAAA records. Hostnames
+// that are not valid domain names or are outside of origin are skipped.
+func WriteZone(w io.Writer, results Results, origin string, apex []dns.RR) error {
+	if origin == "" {
+		origin = ZoneOrigin(results)
+	}
+	if origin == "" {
+		return errors.New("results are not within a single domain, an origin is required")
+	}
+	origin = strings.ToLower(dns.Fqdn(origin))
+	inZone := func(name string) bool {
+		return name == origin || strings.HasSuffix(name, "."+origin)
+	}
+	relative := func(name string) string {
+		if name == origin {
+			return "@"
+		}
+		return strings.TrimSuffix(name, "."+origin)
+	}
+
+	var soa *dns.SOA
+	servers := []string{}
+	for _, rr := range apex {
+		if !strings.EqualFold(rr.Header().Name, origin) {
+			continue
+		}
+		switch v := rr.(type) {
+		case *dns.SOA:
+			soa = v
+		case *dns.NS:
+			servers = append(servers, v.Ns)
+		}
+	}
+	if soa == nil {
+		// Without an address for a nameserver inside the zone, BIND refuses to load
+		// it, so the synthesized nameserver is outside of the zone.
+		soa = &dns.SOA{
+			Hdr:     dns.RR_Header{Name: origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: zoneTTL},
+			Ns:      "localhost.",
+			Mbox:    "hostmaster." + origin,
+			Serial:  1,
+			Refresh: 3600,
+			Retry:   900,
+			Expire:  604800,
+			Minttl:  zoneTTL,
+		}
+	}
+	if len(servers) == 0 {
+		servers = append(servers, soa.Ns)
+	}
+
+	cnames := map[string]string{}
+	for _, r := range results {
+		if !strings.HasPrefix(r.Info, "CNAME ") {
+			continue
+		}
+		name := strings.ToLower(dns.Fqdn(r.Hostname))
+		target := strings.ToLower(dns.Fqdn(strings.TrimPrefix(r.Info, "CNAME ")))
+		// A CNAME cannot exist alongside the SOA and NS records of the origin.
+		if !zoneNameRegex.MatchString(target) || name == origin {
+			continue
+		}
+		cnames[name] = target
+	}
+
+	seen := map[string]bool{}
+	records := []string{}
+	for _, r := range results {
+		name := strings.ToLower(dns.Fqdn(r.Hostname))
+		if !zoneNameRegex.MatchString(name) || !inZone(name) {
+			continue
+		}
+		hdr := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: zoneTTL}
+		var rr dns.RR
+		if target, ok := cnames[name]; ok {
+			hdr.Rrtype = dns.TypeCNAME
+			rr = &dns.CNAME{Hdr: hdr, Target: target}
+		} else if ip := net.ParseIP(r.IP); ip == nil {
+			continue
+		} else if ip.To4() != nil {
+			hdr.Rrtype = dns.TypeA
+			rr = &dns.A{Hdr: hdr, A: ip.To4()}
+		} else {
+			hdr.Rrtype = dns.TypeAAAA
+			rr = &dns.AAAA{Hdr: hdr, AAAA: ip}
+		}
+		// Names are written relative to $ORIGIN.
+		s := relative(name) + strings.TrimPrefix(rr.String(), name)
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		records = append(records, s)
+	}
+	sort.Strings(records)
+
+	head := []string{
+		fmt.Sprintf("$ORIGIN %s", origin),
+		fmt.Sprintf("$TTL %d", zoneTTL),
+		"@" + strings.TrimPrefix(soa.String(), soa.Hdr.Name),
+	}
+	for _, ns := range servers {
+		head = append(head, fmt.Sprintf("@\t%d\tIN\tNS\t%s", zoneTTL, dns.Fqdn(ns)))
+	}
+	for _, s := range append(head, records...) {
+		if _, err := fmt.Fprintln(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package bsw
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const testZoneFile = `$TTL 300
+@       IN SOA ns1 admin 1 7200 3600 1209600 300
+@       IN NS  ns1
+ns1     IN A   192.0.2.53
+www     IN A   192.0.2.80
+www     IN AAAA 2001:db8::80
+web     IN CNAME www
+`
+
+func TestParseZoneFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.example.com")
+	if err := os.WriteFile(path, []byte(testZoneFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ParseZoneFile(path, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 {
+		t.Errorf("expected 6 records from ParseZoneFile, got %d", len(records))
+	}
+	if ips := ZoneAddresses(records); len(ips) != 3 {
+		t.Errorf("expected 3 addresses from ZoneAddresses, got %d", len(ips))
+	}
+	tsk := ZoneRecords(records, "127.0.0.1:1")
+	found := map[string]bool{}
+	for _, r := range tsk.Results() {
+		found[r.IP+" "+r.Hostname+" "+r.Info] = true
+	}
+	for _, want := range []string{
+		"192.0.2.53 ns1.example.com ",
+		"2001:db8::80 www.example.com ",
+		"192.0.2.80 web.example.com CNAME www.example.com",
+	} {
+		if !found[want] {
+			t.Errorf("ZoneRecords did not return %s", want)
+		}
+	}
+}
+
+// parseWrittenZone parses the output of WriteZone without a default origin, so that the
+// relative names it contains require its $ORIGIN directive.
+func parseWrittenZone(t *testing.T, zone string) []dns.RR {
+	zp := dns.NewZoneParser(strings.NewReader(zone), "", "")
+	records := []dns.RR{}
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		records = append(records, rr)
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatalf("WriteZone did not write a valid zone file: %v\n%s", err, zone)
+	}
+	if len(records) == 0 || records[0].Header().Rrtype != dns.TypeSOA || records[0].Header().Name != "example.com." {
+		t.Fatalf("WriteZone did not begin the zone with the SOA of example.com\n%s", zone)
+	}
+	return records
+}
+
+func TestWriteZone(t *testing.T) {
+	results := Results{
+		{Source: "Dictionary IPv4", IP: "192.0.2.80", Hostname: "www.example.com"},
+		{Source: "Dictionary IPv6", IP: "2001:db8::80", Hostname: "www.example.com"},
+		{Source: "Dictionary-CNAME", IP: "192.0.2.80", Hostname: "web.example.com", Info: "CNAME www.example.com"},
+		{Source: "Dictionary-CNAME", IP: "192.0.2.80", Hostname: "WEB.example.com"},
+		{Source: "bing", IP: "192.0.2.81", Hostname: "not a hostname"},
+	}
+	if origin := ZoneOrigin(results); origin != "example.com." {
+		t.Errorf("expected ZoneOrigin to return example.com., got %q", origin)
+	}
+	var buf bytes.Buffer
+	if err := WriteZone(&buf, results, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	records := parseWrittenZone(t, buf.String())
+	types := map[string]uint16{}
+	for _, rr := range records {
+		types[rr.Header().Name] |= 1 << (rr.Header().Rrtype % 16)
+	}
+	if len(records) != 5 {
+		t.Errorf("expected 5 records from WriteZone, got %d\n%s", len(records), buf.String())
+	}
+	if types["example.com."] != 1<<(dns.TypeSOA%16)|1<<(dns.TypeNS%16) {
+		t.Errorf("WriteZone did not write a synthesized SOA and NS for example.com\n%s", buf.String())
+	}
+	if types["web.example.com."] != 1<<(dns.TypeCNAME%16) {
+		t.Errorf("WriteZone did not write a single CNAME for web.example.com\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteZone(&buf, Results{{IP: "192.0.2.1", Hostname: "a.com"}, {IP: "192.0.2.2", Hostname: "b.com"}}, "", nil); err == nil {
+		t.Error("expected an error from WriteZone for results without a common domain")
+	}
+}
+
+func TestWriteZoneApex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.example.com")
+	if err := os.WriteFile(path, []byte(testZoneFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	apex, err := ParseZoneFile(path, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := Results{
+		{Source: "Dictionary IPv4", IP: "192.0.2.80", Hostname: "www.example.com"},
+		{Source: "Dictionary IPv4", IP: "192.0.2.53", Hostname: "ns1.example.com"},
+		{Source: "Headers", IP: "192.0.2.80", Hostname: "cdn.example.net"},
+	}
+	var buf bytes.Buffer
+	if err := WriteZone(&buf, results, "example.com", apex); err != nil {
+		t.Fatal(err)
+	}
+	records := parseWrittenZone(t, buf.String())
+	if soa := records[0].(*dns.SOA); soa.Ns != "ns1.example.com." || soa.Serial != 1 {
+		t.Errorf("WriteZone did not write the SOA from the zone file\n%s", buf.String())
+	}
+	for _, rr := range records {
+		if !dns.IsSubDomain("example.com.", rr.Header().Name) {
+			t.Errorf("WriteZone wrote %s outside of the origin", rr.Header().Name)
+		}
+		if ns, ok := rr.(*dns.NS); ok && ns.Ns != "ns1.example.com." {
+			t.Errorf("WriteZone did not write the NS from the zone file\n%s", buf.String())
+		}
+	}
+	if len(records) != 4 {
+		t.Errorf("expected 4 records from WriteZone, got %d\n%s", len(records), buf.String())
+	}
+}
@@ -2,10 +2,15 @@ package helpers
 
 import (
 	"bufio"
+	"compress/gzip"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"net"
 	"os"
 	"strings"
+
+	"github.com/tomsteele/blacksheepwall/wordlists"
 )
 
 // LinesToIPList processes a list of IP addresses or networks in CIDR format.
@@ -94,3 +99,81 @@ func ReadFileLines(path string) ([]string, error) {
 	}
 	return lines, scanner.Err()
 }
+
+// EachWord calls fn with each word in a wordlist, reading a line at a time so that
+// large lists are not loaded into memory. If path is "-" the list is read from stdin,
+// and if path starts with builtin: the named built-in list is used.
+// Gzip compressed lists are detected and decompressed. Blank lines, lines starting
+// with # and duplicate words are skipped.
+func EachWord(path string, fn func(word string)) error {
+	var r io.Reader = os.Stdin
+	if strings.HasPrefix(path, wordlists.Prefix) {
+		list, err := wordlists.Open(strings.TrimPrefix(path, wordlists.Prefix))
+		if err != nil {
+			return err
+		}
+		defer list.Close()
+		r = list
+	} else if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	// Store a hash of each word rather than the word itself to keep memory use low.
+	seen := map[uint64]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		if sum := h.Sum64(); !seen[sum] {
+			seen[sum] = true
+			fn(word)
+		}
+	}
+	return scanner.Err()
+}
+
+// ReadWords returns every word in a wordlist using EachWord.
+func ReadWords(path string) ([]string, error) {
+	words := []string{}
+	err := EachWord(path, func(word string) {
+		words = append(words, word)
+	})
+	return words, err
+}
+
+// ParentDomains returns each parent of hostname that is a subdomain of domain, not
+// including domain itself. For example, a.b.example.com and example.com
+// returns b.example.com.
+func ParentDomains(hostname, domain string) []string {
+	parents := []string{}
+	hostname = strings.ToLower(strings.TrimRight(hostname, "."))
+	domain = strings.ToLower(strings.TrimRight(domain, "."))
+	if !strings.HasSuffix(hostname, "."+domain) {
+		return parents
+	}
+	labels := strings.Split(strings.TrimSuffix(hostname, "."+domain), ".")
+	for i := 1; i < len(labels); i++ {
+		parents = append(parents, strings.Join(labels[i:], ".")+"."+domain)
+	}
+	return parents
+}
@@ -4,23 +4,28 @@ tools, but has a focus on speed.*/
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
+	"net"
 	"os"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"text/tabwriter"
 
+	"github.com/miekg/dns"
 	"github.com/tomsteele/blacksheepwall/bsw"
 	"github.com/tomsteele/blacksheepwall/helpers"
 )
 
 const usage = `
- Usage: blacksheepwall [options] <ip address or CIDR>
+ Usage: blacksheepwall [options] <ip address, CIDR or hostname>
 
  Options:
   -h, --help            Show Usage and exit.
@@ -40,7 +45,8 @@ const usage = `
 
   -server <string>      DNS server address.  [default: "8.8.8.8"]
 
-  -input <string>       Line separated file of networks (CIDR) or IP Addresses.
+  -input <string>       Line separated file of networks (CIDR) or IP Addresses. Hostnames are
+                        also accepted, and are only used with -tls, -headers and -crawl.
 
   -ipv6                 Look for additional AAAA records where applicable.
 
@@ -50,13 +56,80 @@ const usage = `
   -fcrdns               Verify results by attempting to retrieve the A or AAAA record for
                         each result previously identified hostname.
 
-  -parse <string>       Generate output by parsing JSON from a file from a previous scan.
+  -parse <string>       Generate output by parsing JSON from a file from a previous scan. When used
+                        with -permute, the parsed results are used to generate permutations.
 
   -validate             Validate hostnames using a RFC compliant regex.
 
+  -zone-file <string>   Parse a BIND format zone file into results. Addresses from A and AAAA records
+                        are used as targets for any IP based tasks.
+
+  -zone-origin <string> Origin used for relative names in the file provided to -zone-file when it does
+                        not contain an $ORIGIN directive, and for the zone written with -zone.
+
  Passive:
   -dictionary <string>  Attempt to retrieve the CNAME and A record for
-                        each subdomain in the line separated file.
+                        each subdomain in the line separated file, which may be gzip compressed
+                        or - to read from stdin. Blank lines, lines starting with # and duplicate
+                        names are skipped. A built-in list may be used in place of a file with
+                        builtin:small (100 names), builtin:medium (about 550 names) or
+                        builtin:large (about 1,200 names). Wildcards are detected
+                        using several random names beneath each level a name is guessed
+                        under, and results sharing a wildcard address or CNAME are discarded.
+
+  -mask <string>        Guess subdomains generated from a pattern using the same checks as
+                        -dictionary. Patterns may include ?l (letter), ?d (digit), ?h (hex digit),
+                        ?a (letter or digit), custom classes such as [a-f0-9], numeric ranges
+                        such as {1-20} or zero padded {001-250}, word lists such as {nyc,lon},
+                        and {dict} for each name in the file provided to -dictionary.
+                        For example: srv-{nyc,lon}-{001-050}
+
+  -siblings             Search for registered domains that share the name of each domain, such as
+                        example.de, example.co.uk and example-corp.com for example.com, across a
+                        built-in list of top level domains and public suffixes. Domains with NS or
+                        SOA records are listed on stderr apart from the results.
+
+  -siblings-file <string>
+                        Line separated file of top level domains and public suffixes to use with
+                        -siblings and -typosquat instead of the built-in list.
+
+  -siblings-add         Add each sibling found with -siblings to the list of domains used by all
+                        other domain based options.
+
+  -typosquat            Generate lookalikes of each domain by omitting, transposing, bit flipping
+                        and hyphenating characters, replacing characters with ASCII and IDN
+                        homoglyphs, and swapping the top level domain. Registered lookalikes are
+                        listed on stderr apart from the results, with their addresses, and their
+                        MX and NS records as info.
+
+  -learn                Split every hostname discovered during the run into words on dots, dashes
+                        and digits, and guess each word that was not in the dictionary beneath
+                        every domain using the same checks as -dictionary.
+
+  -learn-file <string>  Write the learned words to a file, most frequent first, for use with
+                        -dictionary in the future. Requires -learn.
+
+  -recursive <int>      Repeat dictionary guessing beneath each discovered subdomain, up to the
+                        provided number of labels below the domain. Only subdomains that have
+                        other names beneath them, are delegated to their own nameservers, or have
+                        a wildcard different from their parent's are used. Requires -dictionary.
+
+  -recursive-dictionary <string>
+                        Line separated file of subdomains to use with -recursive instead of the
+                        file provided to -dictionary.
+
+  -recursive-max <int>  Maximum number of subdomains to guess beneath at each level of -recursive.
+                        [default: 100]
+
+  -permute              Generate permutations of each hostname discovered beneath the domain, or
+                        parsed from -parse, and attempt to retrieve the CNAME and A record for
+                        each. Words are inserted, prefixed and suffixed, numbers are incremented
+                        and decremented, environment names (dev, stage, prod) are swapped and
+                        labels are joined with dashes and dots. Wildcards are filtered as
+                        with -dictionary.
+
+  -permute-words <string>
+                        Line separated file of words to use with -permute instead of the built-in list.
 
   -ns                   Lookup the ip and hostname of any nameservers for the domain.
 
@@ -78,7 +151,13 @@ const usage = `
                         each ip, and '/shodan/host/search' to lookup ips/hostnames for a domain.
                         A single call is made for all ips.
 
-  -reverse              Retrieve the PTR for each host.
+  -reverse              Retrieve the PTR for each host. CNAMEs into RFC 2317 classless delegation
+                        zones are followed, the nameservers of the delegated zone are reported
+                        and a zone transfer of the delegated zone is attempted.
+
+  -reverse6 <string>    Walk the ip6.arpa tree beneath an IPv6 network (CIDR) and retrieve every PTR,
+                        pruning branches that return NXDOMAIN (RFC 8020). Can be a single network
+                        or a file of line separated networks.
 
   -viewdns-html         Lookup each host using viewdns.info's Reverse IP
                         Lookup function. Use sparingly as they will block you.
@@ -98,28 +177,123 @@ const usage = `
   
   -vt                   Searches VirusTotal for subdomains for the provided domain.
 
-  -srv                  Find DNS SRV record and retrieve associated hostname/IP info.
+  -srv                  Find DNS SRV record and retrieve associated hostname/IP info. The service
+                        name, port, priority and weight of each record are included in results.
+                        After other tasks complete, SRV records are also searched for beneath
+                        each discovered hostname and subdomain of the domain, and for each
+                        Active Directory site name found in SRV records.
+
+  -srv-file <string>    Line separated file of SRV service labels (e.g. _ldap._tcp) to search
+                        for in addition to the built-in list. Use builtin:srv for an extended
+                        built-in list of services.
+
+  -srv-max <int>        Maximum number of discovered hostnames and subdomains to search for SRV
+                        records beneath with -srv. Names closest to the domain are searched
+                        first. [default: 100]
 
   -cmn-crawl <string>   Search commoncrawl.org for subdomains of a domain. The provided argument should be the index
                         to be used. For example: "CC-MAIN-2017-04-index"
 
  Active:
-  -axfr                 Attempt a zone transfer on the domain.
+  -axfr                 Attempt a zone transfer on the domain from every address of each nameserver,
+                        falling back to IXFR. Nameservers that allow a transfer are reported.
+
+  -axfr-server <string> Nameserver (host or host:port) to request zone transfers from instead of the
+                        nameservers for the domain. Requires -axfr.
 
-  -headers              Perform HTTP(s) requests to each host and look for
-                        hostnames in a possible Location header.
+  -tsig <string>        TSIG key used to sign zone transfers in the form [algorithm:]name:secret
+                        (e.g. hmac-sha256:transfer-key:c2VjcmV0). Requires -axfr.
+
+  -headers              Perform HTTP(s) requests to each host, following redirects, and look for
+                        hostnames in the Location, Content-Security-Policy,
+                        Access-Control-Allow-Origin, Link, Set-Cookie, Alt-Svc and Refresh
+                        headers and meta refresh tags of each response. The header each name
+                        was found in is included in results. Redirects to other hosts are
+                        only followed when they are beneath the domains provided with -domain.
+
+  -headers-redirects <int>
+                        Maximum number of redirects to follow with -headers. [default: 5]
+
+  -crawl                Crawl the web pages served over HTTP(s) by each host and return hostnames
+                        beneath the domains provided with -domain that are found in links,
+                        script sources, inline JavaScript and JavaScript files. Only the host
+                        itself and hostnames beneath the domains are requested.
+
+  -crawl-depth <int>    Maximum number of links to follow from the first page with -crawl.
+                        [default: 2]
+
+  -crawl-pages <int>    Maximum number of requests made to each host with -crawl. [default: 50]
 
   -tls                  Attempt to retrieve names from TLS certificates
                         (CommonName and Subject Alternative Name).
 
+  -tls-ports <string>   Comma separated list of ports to retrieve certificates from with -tls.
+                        STARTTLS is negotiated on the standard ports for SMTP (25, 587, 2525),
+                        IMAP (143), POP3 (110), FTP (21), LDAP (389), XMPP (5222) and
+                        PostgreSQL (5432). A protocol may be given for other ports, e.g.
+                        2526/smtp, using one of smtp, imap, pop3, ftp, ldap, xmpp, postgres
+                        or tls. [default: 443]
+
+  -sni                  Perform a TLS handshake with each IP, on each port from -tls-ports, using
+                        each domain, each name in the dictionary beneath each domain, and every
+                        hostname discovered for SNI. Names that return a certificate valid for
+                        the name and different from the default certificate are returned.
+
+  -sni-max <int>        Maximum number of names multiplied by IPs to handshake with using -sni.
+                        The handshakes are skipped when there are more. [default: 100000]
+
+  -vhost                Request each IP over HTTP(s) using each domain, each name in the dictionary
+                        beneath each domain, and every hostname discovered as the Host header.
+                        Names that return a response that differs from the response for a
+                        random name beneath the same domain are returned, with the protocol,
+                        status and title of the response.
+
+  -vhost-max <int>      Maximum number of names multiplied by IPs to request with -vhost. The
+                        requests are skipped when there are more. [default: 100000]
+
+  -cert-dump <string>   Write each certificate that names were found in with -tls, -sni or
+                        -crtsh to the provided directory in PEM format, including any chain
+                        presented by the server. Files are named after the SHA-256 fingerprint
+                        of the certificate. The metadata of each certificate, such as the issuer,
+                        serial, fingerprint, validity, key type, organization, email addresses
+                        and chain, is included with results in JSON output.
+
+  -cluster <string>     Group IPs that presented the same certificate with -tls, and IPs with
+                        the same TLS fingerprint, to find load balanced pools and shared
+                        management interfaces. The fingerprint is computed from the version,
+                        cipher suite and ALPN protocol each IP chooses for several different
+                        handshakes on the port it presented a certificate on, similar to JARM.
+                        Groups are written as JSON to the provided file and summarized on stderr.
+
+  -pivot                Search crt.sh, and censys.io when -censys is provided, for certificates
+                        with the same subject organization, organizational unit or email address
+                        as a certificate found with -tls, -sni, -crtsh or -censys. Registrable
+                        domains in those certificates are listed on stderr as proposed targets,
+                        apart from the results. They are only scanned, using every domain based
+                        option, when allowed by -pivot-allow or confirmed with -pivot-confirm.
+
+  -pivot-allow <string> Line separated file of domains that are scanned when proposed by -pivot.
+
+  -pivot-confirm        Prompt on the terminal before scanning each domain proposed by -pivot.
+
+  -http-wildcard <string>
+                        Request each dictionary result over HTTP(s) and compare the response
+                        with the response for a random name beneath the same domain. Results
+                        that are indistinguishable by status, length, title and body are either
+                        tagged ("tag") or dropped ("drop"). Requires -dictionary or -permute.
+
  Output Options:
   -clean                Print results as unique hostnames for each host.
   -csv                  Print results in csv format.
   -json                 Print results as JSON.
+  -zone                 Print results as a BIND zone file containing A, AAAA and CNAME records.
+                        The zone is written for -zone-origin, the domain when a single domain
+                        is given, or the domain every hostname is within. The SOA and NS records
+                        from -zone-file are used when available, otherwise they are synthesized.
 
 `
 
-func readDataAndOutput(path string, ojson, ocsv, oclean bool) {
+func readResults(path string) bsw.Results {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		log.Fatal("Error reading file provided to -parse")
@@ -128,11 +302,21 @@ func readDataAndOutput(path string, ojson, ocsv, oclean bool) {
 	if err := json.Unmarshal(data, &r); err != nil {
 		log.Fatal("Error parsing JSON from file provided to -parse")
 	}
-	output(r, ojson, ocsv, oclean)
+	return r
 }
 
-func output(results bsw.Results, ojson, ocsv, oclean bool) {
+func readDataAndOutput(path string, ojson, ocsv, oclean, ozone bool, origin string) {
+	output(readResults(path), ojson, ocsv, oclean, ozone, origin, nil)
+}
+
+// output prints results in the requested format. Zone files are written for origin, using
+// the SOA and NS records from apex when available.
+func output(results bsw.Results, ojson, ocsv, oclean, ozone bool, origin string, apex []dns.RR) {
 	switch {
+	case ozone:
+		if err := bsw.WriteZone(os.Stdout, results, origin, apex); err != nil {
+			log.Fatal("Error writing zone file " + err.Error())
+		}
 	case ojson:
 		j, _ := json.MarshalIndent(results, "", "    ")
 		fmt.Println(string(j))
@@ -152,9 +336,24 @@ func output(results bsw.Results, ojson, ocsv, oclean bool) {
 			}
 		}
 	default:
+		hasInfo := false
+		for _, r := range results {
+			if r.Info != "" {
+				hasInfo = true
+				break
+			}
+		}
 		w := tabwriter.NewWriter(os.Stdout, 0, 8, 4, ' ', 0)
-		fmt.Fprintln(w, "IP\tHostname\tSource")
+		if hasInfo {
+			fmt.Fprintln(w, "IP\tHostname\tSource\tInfo")
+		} else {
+			fmt.Fprintln(w, "IP\tHostname\tSource")
+		}
 		for _, r := range results {
+			if hasInfo {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.IP, r.Hostname, r.Source, r.Info)
+				continue
+			}
 			fmt.Fprintf(w, "%s\t%s\t%s\n", r.IP, r.Hostname, r.Source)
 		}
 		w.Flush()
@@ -179,9 +378,26 @@ func main() {
 		flIPFile         = flag.String("input", "", "")
 		flParse          = flag.String("parse", "", "")
 		flReverse        = flag.Bool("reverse", false, "")
+		flReverse6       = flag.String("reverse6", "", "")
 		flHeader         = flag.Bool("headers", false, "")
+		flHeaderRedirect = flag.Int("headers-redirects", bsw.DefaultMaxRedirects, "")
+		flCrawl          = flag.Bool("crawl", false, "")
+		flCrawlDepth     = flag.Int("crawl-depth", bsw.DefaultCrawlDepth, "")
+		flCrawlPages     = flag.Int("crawl-pages", bsw.DefaultCrawlPages, "")
 		flTLS            = flag.Bool("tls", false, "")
+		flTLSPorts       = flag.String("tls-ports", "", "")
+		flSNI            = flag.Bool("sni", false, "")
+		flSNIMax         = flag.Int("sni-max", bsw.DefaultSNIMax, "")
+		flVHost          = flag.Bool("vhost", false, "")
+		flVHostMax       = flag.Int("vhost-max", bsw.DefaultVHostMax, "")
+		flCertDump       = flag.String("cert-dump", "", "")
+		flCluster        = flag.String("cluster", "", "")
+		flPivot          = flag.Bool("pivot", false, "")
+		flPivotAllow     = flag.String("pivot-allow", "", "")
+		flPivotConfirm   = flag.Bool("pivot-confirm", false, "")
 		flAXFR           = flag.Bool("axfr", false, "")
+		flAXFRServer     = flag.String("axfr-server", "", "")
+		flTSIG           = flag.String("tsig", "", "")
 		flMX             = flag.Bool("mx", false, "")
 		flNS             = flag.Bool("ns", false, "")
 		flViewDNSInfo    = flag.Bool("viewdns-html", false, "")
@@ -189,6 +405,8 @@ func main() {
 		flLogonTube      = flag.Bool("logontube", false, "")
 		flCommonCrawl    = flag.String("cmn-crawl", "", "")
 		flSRV            = flag.Bool("srv", false, "")
+		flSRVFile        = flag.String("srv-file", "", "")
+		flSRVMax         = flag.Int("srv-max", 100, "")
 		flCRTSH          = flag.Bool("crtsh", false, "")
 		flVT             = flag.Bool("vt", false, "")
 		flBing           = flag.String("bing", "", "")
@@ -199,10 +417,26 @@ func main() {
 		flExfil          = flag.Bool("exfiltrated", false, "")
 		flDomain         = flag.String("domain", "", "")
 		flDictFile       = flag.String("dictionary", "", "")
+		flHTTPWildcard   = flag.String("http-wildcard", "", "")
+		flPermute        = flag.Bool("permute", false, "")
+		flMask           = flag.String("mask", "", "")
+		flSiblings       = flag.Bool("siblings", false, "")
+		flSiblingsFile   = flag.String("siblings-file", "", "")
+		flSiblingsAdd    = flag.Bool("siblings-add", false, "")
+		flTyposquat      = flag.Bool("typosquat", false, "")
+		flLearn          = flag.Bool("learn", false, "")
+		flLearnFile      = flag.String("learn-file", "", "")
+		flRecursive      = flag.Int("recursive", 0, "")
+		flRecursiveDict  = flag.String("recursive-dictionary", "", "")
+		flRecursiveMax   = flag.Int("recursive-max", 100, "")
+		flPermuteWords   = flag.String("permute-words", "", "")
 		flFcrdns         = flag.Bool("fcrdns", false, "")
 		flClean          = flag.Bool("clean", false, "")
 		flCsv            = flag.Bool("csv", false, "")
 		flJSON           = flag.Bool("json", false, "")
+		flZone           = flag.Bool("zone", false, "")
+		flZoneFile       = flag.String("zone-file", "", "")
+		flZoneOrigin     = flag.String("zone-origin", "", "")
 	)
 	flag.Usage = func() { fmt.Print(usage) }
 	flag.Parse()
@@ -212,8 +446,8 @@ func main() {
 		os.Exit(0)
 	}
 
-	if *flParse != "" {
-		readDataAndOutput(*flParse, *flJSON, *flCsv, *flClean)
+	if *flParse != "" && !*flPermute {
+		readDataAndOutput(*flParse, *flJSON, *flCsv, *flClean, *flZone, *flZoneOrigin)
 		os.Exit(0)
 	}
 
@@ -251,15 +485,66 @@ func main() {
 	if !*flReverse {
 		*flReverse = config.Reverse
 	}
+	if *flReverse6 == "" {
+		*flReverse6 = config.Reverse6
+	}
 	if !*flHeader {
 		*flHeader = config.Headers
 	}
+	if config.MaxRedirects != 0 && *flHeaderRedirect == bsw.DefaultMaxRedirects {
+		*flHeaderRedirect = config.MaxRedirects
+	}
+	if !*flCrawl {
+		*flCrawl = config.Crawl
+	}
+	if config.CrawlDepth != 0 && *flCrawlDepth == bsw.DefaultCrawlDepth {
+		*flCrawlDepth = config.CrawlDepth
+	}
+	if config.CrawlPages != 0 && *flCrawlPages == bsw.DefaultCrawlPages {
+		*flCrawlPages = config.CrawlPages
+	}
 	if !*flTLS {
 		*flTLS = config.TLS
 	}
+	if *flTLSPorts == "" {
+		*flTLSPorts = config.TLSPorts
+	}
+	if !*flSNI {
+		*flSNI = config.SNI
+	}
+	if config.SNIMax != 0 && *flSNIMax == bsw.DefaultSNIMax {
+		*flSNIMax = config.SNIMax
+	}
+	if !*flVHost {
+		*flVHost = config.VHost
+	}
+	if config.VHostMax != 0 && *flVHostMax == bsw.DefaultVHostMax {
+		*flVHostMax = config.VHostMax
+	}
+	if *flCertDump == "" {
+		*flCertDump = config.CertDump
+	}
+	if *flCluster == "" {
+		*flCluster = config.Cluster
+	}
+	if !*flPivot {
+		*flPivot = config.Pivot
+	}
+	if *flPivotAllow == "" {
+		*flPivotAllow = config.PivotAllow
+	}
+	if !*flPivotConfirm {
+		*flPivotConfirm = config.PivotConfirm
+	}
 	if !*flAXFR {
 		*flAXFR = config.AXFR
 	}
+	if *flAXFRServer == "" {
+		*flAXFRServer = config.AXFRServer
+	}
+	if *flTSIG == "" {
+		*flTSIG = config.TSIG
+	}
 	if !*flMX {
 		*flMX = config.MX
 	}
@@ -284,6 +569,12 @@ func main() {
 	if !*flSRV {
 		*flSRV = config.SRV
 	}
+	if *flSRVFile == "" {
+		*flSRVFile = config.SRVFile
+	}
+	if config.SRVMax != 0 && *flSRVMax == 100 {
+		*flSRVMax = config.SRVMax
+	}
 	if *flBing == "" {
 		*flBing = config.Bing
 	}
@@ -311,6 +602,51 @@ func main() {
 	if !*flFcrdns {
 		*flFcrdns = config.FCRDNS
 	}
+	if *flHTTPWildcard == "" {
+		*flHTTPWildcard = config.HTTPWildcard
+	}
+	if !*flPermute {
+		*flPermute = config.Permute
+	}
+	if *flMask == "" {
+		*flMask = config.Mask
+	}
+	if !*flLearn {
+		*flLearn = config.Learn
+	}
+	if !*flSiblings {
+		*flSiblings = config.Siblings
+	}
+	if *flSiblingsFile == "" {
+		*flSiblingsFile = config.SiblingsFile
+	}
+	if !*flSiblingsAdd {
+		*flSiblingsAdd = config.SiblingsAdd
+	}
+	if !*flTyposquat {
+		*flTyposquat = config.Typosquat
+	}
+	if *flLearnFile == "" {
+		*flLearnFile = config.LearnFile
+	}
+	if *flRecursive == 0 {
+		*flRecursive = config.Recursive
+	}
+	if *flRecursiveDict == "" {
+		*flRecursiveDict = config.RecursiveDict
+	}
+	if config.RecursiveMax != 0 && *flRecursiveMax == 100 {
+		*flRecursiveMax = config.RecursiveMax
+	}
+	if *flPermuteWords == "" {
+		*flPermuteWords = config.PermuteWords
+	}
+	if *flZoneFile == "" {
+		*flZoneFile = config.ZoneFile
+	}
+	if *flZoneOrigin == "" {
+		*flZoneOrigin = config.ZoneOrigin
+	}
 
 	// Holds all IP addresses for testing.
 	ipAddrList := []string{}
@@ -320,8 +656,24 @@ func main() {
 	if err == nil {
 		isStdIn = (stat.Mode() & os.ModeCharDevice) == 0
 	}
+	// Stdin is used for a wordlist rather than results when requested.
+	fromStdIn := 0
+	for _, f := range []string{*flDictFile, *flRecursiveDict, *flPermuteWords, *flSRVFile, *flSiblingsFile, *flPivotAllow} {
+		if f == "-" {
+			fromStdIn++
+		}
+	}
+	if fromStdIn > 1 {
+		log.Fatal("Only one wordlist can be read from stdin")
+	}
+	if fromStdIn == 1 {
+		if !isStdIn {
+			log.Fatal("A wordlist was to be read from stdin, but nothing was piped")
+		}
+		isStdIn = false
+	}
 	// Verify that some sort of work load was given in commands.
-	if !isStdIn && *flIPFile == "" && *flDomain == "" && len(flag.Args()) < 1 {
+	if !isStdIn && *flIPFile == "" && *flDomain == "" && *flReverse6 == "" && *flZoneFile == "" && len(flag.Args()) < 1 {
 		log.Fatal("You didn't provide any work for me to do")
 	}
 	if *flYandex != "" && *flDomain == "" {
@@ -330,9 +682,51 @@ func main() {
 	if *flDictFile != "" && *flDomain == "" {
 		log.Fatal("Dictionary lookup requires domain set with -domain")
 	}
+	if *flHTTPWildcard != "" && *flDictFile == "" && *flMask == "" && !*flPermute {
+		log.Fatal("-http-wildcard requires -dictionary, -mask or -permute")
+	}
+	if *flMask != "" && *flDomain == "" {
+		log.Fatal("-mask requires domain set with -domain")
+	}
+	if *flSiblings && *flDomain == "" {
+		log.Fatal("-siblings requires domain set with -domain")
+	}
+	if *flSiblingsAdd && !*flSiblings {
+		log.Fatal("-siblings-add requires -siblings")
+	}
+	if *flTyposquat && *flDomain == "" {
+		log.Fatal("-typosquat requires domain set with -domain")
+	}
+	if *flSiblingsFile != "" && !*flSiblings && !*flTyposquat {
+		log.Fatal("-siblings-file requires -siblings or -typosquat")
+	}
+	if *flLearn && *flDomain == "" {
+		log.Fatal("-learn requires domain set with -domain")
+	}
+	if *flLearnFile != "" && !*flLearn {
+		log.Fatal("-learn-file requires -learn")
+	}
+	if *flRecursive > 0 && *flDictFile == "" {
+		log.Fatal("-recursive requires -dictionary")
+	}
+	if *flRecursiveDict != "" && *flRecursive < 1 {
+		log.Fatal("-recursive-dictionary requires -recursive")
+	}
+	if *flPermute && *flDomain == "" {
+		log.Fatal("Permutations require domain set with -domain")
+	}
+	if *flPermuteWords != "" && !*flPermute {
+		log.Fatal("-permute-words requires -permute")
+	}
+	if *flHTTPWildcard != "" && *flHTTPWildcard != "tag" && *flHTTPWildcard != "drop" {
+		log.Fatal("-http-wildcard must be tag or drop")
+	}
 	if *flDomain == "" && *flSRV == true {
 		log.Fatal("SRV lookup requires domain set with -domain")
 	}
+	if *flSRVFile != "" && !*flSRV {
+		log.Fatal("-srv-file requires -srv")
+	}
 	if *flExfil && *flDomain == "" {
 		log.Fatal("Exfiltrated requires domain set with -domain")
 	}
@@ -351,10 +745,13 @@ func main() {
 	if *flAXFR && *flDomain == "" {
 		log.Fatal("Zone transfer requires domain set with -domain")
 	}
+	if (*flAXFRServer != "" || *flTSIG != "") && !*flAXFR {
+		log.Fatal("-axfr-server and -tsig require -axfr")
+	}
 	if *flCommonCrawl != "" && *flDomain == "" {
 		log.Fatal("Common Crawl requires domain set with -domain")
 	}
-	if *flDomain != "" && *flYandex == "" && *flDictFile == "" && !*flSRV && !*flLogonTube && *flShodan == "" && *flBing == "" && !*flBingHTML && !*flAXFR && !*flNS && !*flMX && !*flVT && !*flCRTSH && !*flExfil && *flCensys == "" && *flCommonCrawl == "" {
+	if *flDomain != "" && !*flCrawl && !*flLearn && !*flSNI && !*flVHost && !*flPivot && *flYandex == "" && *flDictFile == "" && *flMask == "" && !*flSiblings && !*flTyposquat && !*flPermute && !*flSRV && !*flLogonTube && *flShodan == "" && *flBing == "" && !*flBingHTML && !*flAXFR && !*flNS && !*flMX && !*flVT && !*flCRTSH && !*flExfil && *flCensys == "" && *flCommonCrawl == "" {
 		log.Fatal("-domain provided but no methods provided that use it")
 	}
 
@@ -372,33 +769,182 @@ func main() {
 		}
 	}
 
-	// Get first argument that is not an option and turn it into a list of IPs.
-	if len(flag.Args()) > 0 {
-		flNetwork := flag.Arg(0)
-		list, err := helpers.LinesToIPList([]string{flNetwork})
+	// Build list of IPv6 networks to walk.
+	networks6 := []string{}
+	if *flReverse6 != "" {
+		if _, err := os.Stat(*flReverse6); os.IsNotExist(err) {
+			networks6 = append(networks6, *flReverse6)
+		} else {
+			lines, err := helpers.ReadFileLines(*flReverse6)
+			if err != nil {
+				log.Fatal("Error reading " + *flReverse6 + " " + err.Error())
+			}
+			networks6 = append(networks6, lines...)
+		}
+	}
+
+	// Parse the TSIG key used for zone transfers.
+	var tsigKey *bsw.TSIGKey
+	if *flTSIG != "" {
+		k, err := bsw.ParseTSIGKey(*flTSIG)
 		if err != nil {
-			log.Fatal(err.Error())
+			log.Fatal("Error parsing -tsig " + err.Error())
+		}
+		tsigKey = k
+	}
+
+	// Build list of words used for permutations.
+	permuteWords := bsw.PermutationWords
+	if *flPermuteWords != "" {
+		lines, err := helpers.ReadWords(*flPermuteWords)
+		if err != nil {
+			log.Fatal("Error reading " + *flPermuteWords + " " + err.Error())
+		}
+		permuteWords = lines
+	}
+
+	if *flHeaderRedirect < 0 {
+		log.Fatal("-headers-redirects must not be negative")
+	}
+	if *flCrawl && *flDomain == "" {
+		log.Fatal("-crawl requires domain set with -domain")
+	}
+	if *flCrawlDepth < 0 || *flCrawlPages < 1 {
+		log.Fatal("-crawl-depth must not be negative and -crawl-pages must be at least 1")
+	}
+	if *flSNIMax < 1 {
+		log.Fatal("-sni-max must be at least 1")
+	}
+	if *flVHostMax < 1 {
+		log.Fatal("-vhost-max must be at least 1")
+	}
+	if *flSRVMax < 0 {
+		log.Fatal("-srv-max must not be negative")
+	}
+	if *flCluster != "" && !*flTLS {
+		log.Fatal("-cluster requires -tls")
+	}
+	if *flPivot && !*flTLS && !*flSNI && !*flCRTSH && *flCensys == "" {
+		log.Fatal("-pivot requires -tls, -sni, -crtsh or -censys")
+	}
+	if (*flPivotAllow != "" || *flPivotConfirm) && !*flPivot {
+		log.Fatal("-pivot-allow and -pivot-confirm require -pivot")
+	}
+	if *flPivotConfirm && (isStdIn || fromStdIn > 0) {
+		log.Fatal("-pivot-confirm requires stdin to be a terminal")
+	}
+
+	// Build the set of domains that are scanned when proposed by -pivot.
+	pivotAllow := map[string]bool{}
+	if *flPivotAllow != "" {
+		lines, err := helpers.ReadWords(*flPivotAllow)
+		if err != nil {
+			log.Fatal("Error reading " + *flPivotAllow + " " + err.Error())
+		}
+		for _, l := range lines {
+			pivotAllow[strings.ToLower(strings.Trim(l, "."))] = true
+		}
+	}
+
+	// Build list of ports to retrieve certificates from.
+	tlsPorts := bsw.DefaultTLSPorts
+	if *flTLSPorts != "" {
+		if !*flTLS && !*flSNI {
+			log.Fatal("-tls-ports requires -tls or -sni")
+		}
+		ports, err := bsw.ParseTLSPorts(*flTLSPorts)
+		if err != nil {
+			log.Fatal("Error parsing -tls-ports: " + err.Error())
+		}
+		tlsPorts = ports
+	}
+
+	// Build list of public suffixes used to find sibling domains.
+	suffixes := bsw.PublicSuffixes
+	if *flSiblingsFile != "" {
+		lines, err := helpers.ReadWords(*flSiblingsFile)
+		if err != nil {
+			log.Fatal("Error reading " + *flSiblingsFile + " " + err.Error())
 		}
-		ipAddrList = append(ipAddrList, list...)
+		suffixes = lines
+	}
+
+	// Build list of SRV services.
+	srvServices := bsw.SRVServices
+	if *flSRVFile != "" {
+		lines, err := helpers.ReadWords(*flSRVFile)
+		if err != nil {
+			log.Fatal("Error reading " + *flSRVFile + " " + err.Error())
+		}
+		srvServices = append(lines, srvServices...)
+	}
+
+	// Turn each target into a list of IPs and append it to ipAddrList. Hostnames, which may
+	// include a port, are only connected to by -tls, -headers and -crawl and are kept in
+	// hostTargets. Will fail fatally if a target is not a valid IP, network or hostname.
+	hostTargets := []string{}
+	parseTargets := func(lines []string) {
+		for _, line := range lines {
+			list, err := helpers.LinesToIPList([]string{line})
+			if err == nil {
+				ipAddrList = append(ipAddrList, list...)
+				continue
+			}
+			host := strings.ToLower(line)
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if ok, _ := regexp.MatchString(bsw.DomainRegex, host); !ok || !strings.ContainsAny(host, "abcdefghijklmnopqrstuvwxyz") {
+				log.Fatal(err.Error())
+			}
+			hostTargets = append(hostTargets, strings.ToLower(line))
+		}
+	}
+
+	// Get first argument that is not an option and turn it into a list of IPs.
+	if len(flag.Args()) > 0 {
+		parseTargets([]string{flag.Arg(0)})
 	}
 
 	// If file given as -input, read lines and turn each possible IP or network into
-	// a list of IPs. Appends list to ipAddrList. Will fail fatally if line in file
-	// is not a valid IP or CIDR range.
+	// a list of IPs.
 	if *flIPFile != "" {
 		lines, err := helpers.ReadFileLines(*flIPFile)
 		if err != nil {
 			log.Fatal("Error reading " + *flIPFile + " " + err.Error())
 		}
-		list, err := helpers.LinesToIPList(lines)
+		parseTargets(lines)
+	}
+	if len(hostTargets) > 0 && !*flTLS && !*flHeader && !*flCrawl {
+		log.Fatal("Hostname targets can only be used with -tls, -headers or -crawl")
+	}
+
+	// If a zone file is given as -zone-file, parse all records and add each address
+	// to ipAddrList.
+	var zoneRecords []dns.RR
+	if *flZoneFile != "" {
+		records, err := bsw.ParseZoneFile(*flZoneFile, *flZoneOrigin)
 		if err != nil {
-			log.Fatal(err.Error())
+			log.Fatal("Error reading " + *flZoneFile + " " + err.Error())
 		}
-		ipAddrList = append(ipAddrList, list...)
+		zoneRecords = records
+		ipAddrList = append(ipAddrList, bsw.ZoneAddresses(zoneRecords)...)
 	}
 
 	// Use a map that acts like a set to store only unique results.
-	resMap := make(map[bsw.Result]bool)
+	resMap := make(map[bsw.ResultKey]bsw.Result)
+
+	// Domains proposed by -siblings, -typosquat and -pivot are registered domains rather
+	// than hosts, and are kept apart from results. Each is stored once per source, with the
+	// smallest info for a domain proposed more than once.
+	domainMap := make(map[string]bsw.Domain)
+
+	// If a file from a previous scan is given to -parse, use its results.
+	if *flParse != "" {
+		for _, r := range readResults(*flParse) {
+			resMap[r.Key()] = r
+		}
+	}
 
 	if isStdIn {
 		stdin, err := ioutil.ReadAll(os.Stdin)
@@ -409,10 +955,19 @@ func main() {
 			}
 			for _, r := range pipedResults {
 				ipAddrList = append(ipAddrList, r.IP)
-				resMap[r] = true
+				resMap[r.Key()] = r
 			}
 		}
 	}
+	if *flSNI && len(ipAddrList) == 0 {
+		log.Fatal("-sni requires IP addresses to connect to")
+	}
+	if *flVHost && len(ipAddrList) == 0 {
+		log.Fatal("-vhost requires IP addresses to connect to")
+	}
+	if *flCrawl && len(ipAddrList) == 0 && len(hostTargets) == 0 {
+		log.Fatal("-crawl requires IP addresses or hostnames to connect to")
+	}
 
 	// tracker: Chanel uses an empty struct to track when all goroutines in the pool
 	//          have completed as well as a single call from the gatherer.
@@ -422,9 +977,18 @@ func main() {
 	//
 	// res:     When each task is called in the pool, it will send valid results to
 	//          the res channel.
+	//
+	// pending: Tracks tasks that have been queued but whose results have not been
+	//          ingested. Waiting on pending allows additional tasks to be queued
+	//          using the results of the tasks before them.
 	tracker := make(chan empty)
 	tasks := make(chan task, *flConcurrency)
 	res := make(chan *bsw.Tsk, *flConcurrency)
+	var pending sync.WaitGroup
+	queue := func(fn task) {
+		pending.Add(1)
+		tasks <- fn
+	}
 
 	// Start up *flConcurrency amount of goroutines.
 	log.Printf("Spreading tasks across %d goroutines", *flConcurrency)
@@ -438,96 +1002,118 @@ func main() {
 	}
 
 	// Ingest incoming results.
-	go func() {
-		c := 0
-		for t := range res {
-			if !*flDebug {
-				if m := c % 2; m == 0 {
-					c = 3
-					os.Stderr.WriteString("\rWorking \\")
-				} else {
-					c = 2
-					os.Stderr.WriteString("\rWorking /")
-				}
-			}
-			if err := t.Err(); err != nil && *flDebug {
-				log.Printf("%v: %v", t.Task(), err)
-				continue
+	c := 0
+	ingest := func(t *bsw.Tsk) {
+		if !*flDebug {
+			if m := c % 2; m == 0 {
+				c = 3
+				os.Stderr.WriteString("\rWorking \\")
+			} else {
+				c = 2
+				os.Stderr.WriteString("\rWorking /")
 			}
-			if t.Err() != nil {
-				continue
+		}
+		if err := t.Err(); err != nil && *flDebug {
+			log.Printf("%v: %v", t.Task(), err)
+		}
+		if t.Err() != nil {
+			return
+		}
+		for _, d := range t.Domains() {
+			k := d.Source + " " + d.Name
+			if prev, ok := domainMap[k]; !ok || d.Info < prev.Info {
+				domainMap[k] = d
 			}
-			if !t.HasResults() {
-				continue
+		}
+		if !t.HasResults() {
+			return
+		}
+		result := t.Results()
+		if *flDebug {
+			log.Printf("%v: %v %v: task completed successfully\n", t.Task(), result[0].Hostname, result[0].IP)
+		}
+		// Results that are only used by later passes are stored as is.
+		if t.Task() == bsw.TaskHTTPWildcard || t.Task() == bsw.TaskTLSFingerprint {
+			for _, r := range result {
+				resMap[r.Key()] = r
 			}
-			result := t.Results()
-			if *flDebug {
-				log.Printf("%v: %v %v: task completed successfully\n", t.Task(), result[0].Hostname, result[0].IP)
+			return
+		}
+		if *flFcrdns {
+			// The certificate of a result is kept so that it is available to -cert-dump,
+			// -cluster and -pivot.
+			add := func(ip, hostname string, cert *bsw.Certificate) {
+				r := bsw.Result{Source: "fcrdns", IP: ip, Hostname: hostname, Certificate: cert}
+				resMap[r.Key()] = r
 			}
-			if *flFcrdns {
-				for _, r := range result {
-					r.Hostname = strings.ToLower(r.Hostname)
-					ips, err := bsw.LookupName(r.Hostname, *flServerAddr)
-					if err == nil {
-						for _, ip := range ips {
-							resMap[bsw.Result{Source: "fcrdns", IP: ip, Hostname: r.Hostname}] = true
-						}
-						continue
+			for _, r := range result {
+				r.Hostname = strings.ToLower(r.Hostname)
+				ips, err := bsw.LookupName(r.Hostname, *flServerAddr)
+				if err == nil {
+					for _, ip := range ips {
+						add(ip, r.Hostname, r.Certificate)
+					}
+					continue
+				}
+				var (
+					ecount    int
+					cfqdn     string
+					cfqdns    []string
+					isErrored bool
+				)
+				tfqdn := r.Hostname
+				for {
+					cfqdn, err = bsw.LookupCname(tfqdn, *flServerAddr)
+					if err != nil {
+						isErrored = true
+						break
 					}
-					var (
-						ecount    int
-						cfqdn     string
-						cfqdns    []string
-						isErrored bool
-					)
-					tfqdn := r.Hostname
-					for {
-						cfqdn, err = bsw.LookupCname(tfqdn, *flServerAddr)
-						if err != nil {
+					cfqdns = append(cfqdns, cfqdn)
+					ips, err = bsw.LookupName(cfqdn, *flServerAddr)
+					if err != nil {
+						ecount++
+						if ecount > 10 {
 							isErrored = true
 							break
 						}
-						cfqdns = append(cfqdns, cfqdn)
-						ips, err = bsw.LookupName(cfqdn, *flServerAddr)
-						if err != nil {
-							ecount++
-							if ecount > 10 {
-								isErrored = true
-								break
-							}
-							tfqdn = cfqdn
-							continue
+						tfqdn = cfqdn
+						continue
+					}
+					break
+				}
+				if !isErrored {
+					for _, ip := range ips {
+						add(ip, r.Hostname, r.Certificate)
+						for _, c := range cfqdns {
+							add(ip, c, nil)
 						}
-						break
 					}
-					if !isErrored {
+				} else {
+					ips, err = bsw.LookupName6(r.Hostname, *flServerAddr)
+					if err == nil {
 						for _, ip := range ips {
-							resMap[bsw.Result{Source: "fcrdns", IP: ip, Hostname: r.Hostname}] = true
-							for _, c := range cfqdns {
-								resMap[bsw.Result{Source: "fcrdns", IP: ip, Hostname: c}] = true
-							}
-						}
-					} else {
-						ips, err = bsw.LookupName6(r.Hostname, *flServerAddr)
-						if err == nil {
-							for _, ip := range ips {
-								resMap[bsw.Result{Source: "fcrdns", IP: ip, Hostname: r.Hostname}] = true
-							}
+							add(ip, r.Hostname, r.Certificate)
 						}
 					}
 				}
-			} else {
-				for _, r := range result {
-					r.Hostname = strings.ToLower(r.Hostname)
-					if *flValidate {
-						if ok, err := regexp.Match(bsw.DomainRegex, []byte(r.Hostname)); err != nil || !ok {
-							continue
-						}
+			}
+		} else {
+			for _, r := range result {
+				r.Hostname = strings.ToLower(r.Hostname)
+				if *flValidate {
+					if ok, err := regexp.Match(bsw.DomainRegex, []byte(r.Hostname)); err != nil || !ok {
+						continue
 					}
-					resMap[r] = true
 				}
+				resMap[r.Key()] = r
 			}
 		}
+	}
+	go func() {
+		for t := range res {
+			ingest(t)
+			pending.Done()
+		}
 		tracker <- empty{}
 	}()
 
@@ -541,126 +1127,629 @@ func main() {
 		bingPath = p
 	}
 
+	if len(zoneRecords) > 0 {
+		queue(func() *bsw.Tsk { return bsw.ZoneRecords(zoneRecords, *flServerAddr) })
+	}
+
 	if *flShodan != "" && len(ipAddrList) > 0 {
-		tasks <- func() *bsw.Tsk { return bsw.ShodanAPIReverse(ipAddrList, *flShodan) }
+		queue(func() *bsw.Tsk { return bsw.ShodanAPIReverse(ipAddrList, *flShodan) })
 	}
 
 	// IP based functionality should be added to the pool here.
+	classless := bsw.NewClasslessZones()
 	for _, h := range ipAddrList {
 		host := h
 		if *flReverse {
-			tasks <- func() *bsw.Tsk { return bsw.Reverse(host, *flServerAddr) }
+			queue(func() *bsw.Tsk { return bsw.Reverse(host, *flServerAddr, classless) })
 		}
 		if *flTLS {
-			tasks <- func() *bsw.Tsk { return bsw.TLS(host, *flTimeout) }
+			queue(func() *bsw.Tsk { return bsw.TLS(host, tlsPorts, *flTimeout) })
 		}
 		if *flViewDNSInfo {
-			tasks <- func() *bsw.Tsk { return bsw.ViewDNSInfo(host) }
+			queue(func() *bsw.Tsk { return bsw.ViewDNSInfo(host) })
 		}
 		if *flViewDNSInfoAPI != "" {
-			tasks <- func() *bsw.Tsk { return bsw.ViewDNSInfoAPI(host, *flViewDNSInfoAPI) }
+			queue(func() *bsw.Tsk { return bsw.ViewDNSInfoAPI(host, *flViewDNSInfoAPI) })
 		}
 		if *flLogonTube {
-			tasks <- func() *bsw.Tsk { return bsw.LogonTubeAPI(host) }
+			queue(func() *bsw.Tsk { return bsw.LogonTubeAPI(host) })
 		}
 		if *flBingHTML {
-			tasks <- func() *bsw.Tsk { return bsw.BingIP(host) }
+			queue(func() *bsw.Tsk { return bsw.BingIP(host) })
 		}
 		if *flBing != "" && bingPath != "" {
-			tasks <- func() *bsw.Tsk { return bsw.BingAPIIP(host, *flBing, bingPath) }
+			queue(func() *bsw.Tsk { return bsw.BingAPIIP(host, *flBing, bingPath) })
+		}
+		if *flHeader {
+			queue(func() *bsw.Tsk { return bsw.Headers(host, domains, *flHeaderRedirect, *flTimeout) })
+		}
+		if *flCrawl {
+			queue(func() *bsw.Tsk { return bsw.Crawl(host, domains, *flCrawlDepth, *flCrawlPages, *flTimeout) })
+		}
+	}
+
+	// Hostname targets are only connected to directly.
+	for _, h := range hostTargets {
+		host := h
+		if *flTLS {
+			queue(func() *bsw.Tsk { return bsw.TLS(host, tlsPorts, *flTimeout) })
 		}
 		if *flHeader {
-			tasks <- func() *bsw.Tsk { return bsw.Headers(host, *flTimeout) }
+			queue(func() *bsw.Tsk { return bsw.Headers(host, domains, *flHeaderRedirect, *flTimeout) })
 		}
+		if *flCrawl {
+			queue(func() *bsw.Tsk { return bsw.Crawl(host, domains, *flCrawlDepth, *flCrawlPages, *flTimeout) })
+		}
+	}
+
+	// Walk the ip6.arpa tree for each IPv6 network.
+	for _, n := range networks6 {
+		network := n
+		queue(func() *bsw.Tsk { return bsw.ReverseWalk6(network, *flServerAddr) })
 	}
 
 	// Domain based functions will likely require separate blocks and should be added below.
 
-	// Subdomain dictionary guessing.
-	for _, d := range domains {
-		domain := d
+	// Search for registered lookalikes of each domain.
+	if *flTyposquat {
+		for _, d := range domains {
+			for _, l := range bsw.Typosquats(d, suffixes) {
+				domain, lookalike := d, l
+				queue(func() *bsw.Tsk { return bsw.Typosquat(domain, lookalike, *flServerAddr) })
+			}
+		}
+	}
+
+	// Search for registered siblings of each domain across other public suffixes. When
+	// requested, siblings are added to the list of domains used by the tasks below.
+	if *flSiblings {
+		for _, d := range domains {
+			for _, c := range bsw.SiblingDomains(d, suffixes) {
+				domain, candidate := d, c
+				queue(func() *bsw.Tsk { return bsw.Sibling(domain, candidate, *flServerAddr) })
+			}
+		}
+		pending.Wait()
+		if *flSiblingsAdd {
+			known := map[string]bool{}
+			for _, d := range domains {
+				known[strings.ToLower(d)] = true
+			}
+			for _, d := range domainMap {
+				if d.Source == bsw.TaskSiblingDomain && !known[d.Name] {
+					known[d.Name] = true
+					domains = append(domains, d.Name)
+				}
+			}
+		}
+	}
+
+	// The dictionary is streamed from disk and shared across domains. It is only held in
+	// memory when the words are needed more than once, by {dict} in a mask or by -recursive,
+	// or when it is read from stdin, which can only be read once.
+	var dictList []string
+	if *flDictFile != "" && (*flDictFile == "-" || strings.Contains(*flMask, "{dict}") || (*flRecursive > 0 && *flRecursiveDict == "")) {
+		words, err := helpers.ReadWords(*flDictFile)
+		if err != nil {
+			log.Fatal("Error reading " + *flDictFile + " " + err.Error())
+		}
+		dictList = words
+	}
+
+	// Parse the mask, which may use names from the dictionary file.
+	var mask *bsw.Mask
+	if *flMask != "" {
+		m, err := bsw.ParseMask(*flMask, dictList)
+		if err != nil {
+			log.Fatal("Error parsing mask: " + err.Error())
+		}
+		mask = m
+		if n := mask.Count(); n == math.MaxUint64 {
+			log.Printf("Mask %s generates more names than can be counted for each domain", *flMask)
+		} else {
+			log.Printf("Mask %s generates %d names for each domain, %d total", *flMask, n, n*uint64(len(domains)))
+		}
+	}
+
+	// Wildcards are detected for each domain level that names are guessed beneath and are
+	// used to discard dictionary results.
+	wildcards := bsw.NewWildcardCache(*flServerAddr, *flipv6)
+
+	// Queue the dictionary and every other domain based task for each of domains. This is
+	// used for the domains provided and for domains proposed by -pivot that are scanned.
+	scanDomains := func(domains []string) {
+		// Subdomain dictionary guessing. Each word is guessed beneath every domain as it is read,
+		// queueing blocks while the pool is busy so only a small part of the list is pending.
 		if *flDictFile != "" {
-			nameList, err := helpers.ReadFileLines(*flDictFile)
-			if err != nil {
-				log.Fatal("Error reading " + *flDictFile + " " + err.Error())
+			guess := func(sub string) {
+				for _, d := range domains {
+					domain := d
+					queue(func() *bsw.Tsk { return bsw.Dictionary(domain, sub, wildcards, *flServerAddr) })
+					if *flipv6 {
+						queue(func() *bsw.Tsk { return bsw.Dictionary6(domain, sub, wildcards, *flServerAddr) })
+					}
+				}
 			}
-			// Get an IP for a possible wildcard domain and use it as a blacklist.
-			blacklist := bsw.GetWildCards(domain, *flServerAddr)
-			for _, wildcardIp := range blacklist {
-				ip := wildcardIp
-				tasks <- func() *bsw.Tsk {
-					t := &bsw.Tsk{}
-					t.SetTask("Wildcard IPv4")
-					t.AddResult(ip, "*."+domain)
-					return t
+			if dictList != nil {
+				for _, w := range dictList {
+					guess(w)
 				}
+			} else if err := helpers.EachWord(*flDictFile, guess); err != nil {
+				log.Fatal("Error reading " + *flDictFile + " " + err.Error())
+			}
+		}
+
+		for _, d := range domains {
+			domain := d
+			if mask != nil {
+				mask.Each(func(name string) bool {
+					sub := name
+					queue(func() *bsw.Tsk { return bsw.Dictionary(domain, sub, wildcards, *flServerAddr) })
+					if *flipv6 {
+						queue(func() *bsw.Tsk { return bsw.Dictionary6(domain, sub, wildcards, *flServerAddr) })
+					}
+					return true
+				})
+			}
+
+			if *flExfil {
+				queue(func() *bsw.Tsk { return bsw.ExfiltratedHostname(domain, *flServerAddr) })
 			}
-			var blacklist6 []string
-			if *flipv6 {
-				blacklist6 = bsw.GetWildCards6(domain, *flServerAddr)
-				for _, wildcardIp := range blacklist6 {
-					ip := wildcardIp
-					tasks <- func() *bsw.Tsk {
-						t := &bsw.Tsk{}
-						t.SetTask("Wildcard IPv6")
-						t.AddResult(ip, "*."+domain)
-						return t
+			if *flSRV {
+				queue(func() *bsw.Tsk { return bsw.SRV(domain, srvServices, *flServerAddr) })
+			}
+			if *flYandex != "" {
+				queue(func() *bsw.Tsk { return bsw.YandexAPI(domain, *flYandex, *flServerAddr) })
+			}
+			if *flLogonTube {
+				queue(func() *bsw.Tsk { return bsw.LogonTubeAPI(domain) })
+			}
+			if *flShodan != "" {
+				queue(func() *bsw.Tsk { return bsw.ShodanAPIHostSearch(domain, *flShodan) })
+			}
+			if *flBing != "" && bingPath != "" {
+				queue(func() *bsw.Tsk { return bsw.BingAPIDomain(domain, *flBing, bingPath, *flServerAddr) })
+			}
+			if *flBingHTML {
+				queue(func() *bsw.Tsk { return bsw.BingDomain(domain, *flServerAddr) })
+			}
+			if *flAXFR && *flAXFRServer != "" {
+				queue(func() *bsw.Tsk { return bsw.AXFRServer(domain, *flAXFRServer, tsigKey, *flServerAddr) })
+			} else if *flAXFR {
+				queue(func() *bsw.Tsk { return bsw.AXFR(domain, *flServerAddr, tsigKey) })
+			}
+			if *flNS {
+				queue(func() *bsw.Tsk { return bsw.NS(domain, *flServerAddr) })
+			}
+			if *flMX {
+				queue(func() *bsw.Tsk { return bsw.MX(domain, *flServerAddr) })
+			}
+			if *flCensys != "" {
+				queue(func() *bsw.Tsk { return bsw.CensysDomain(domain, *flCensys) })
+			}
+			if *flCommonCrawl != "" {
+				queue(func() *bsw.Tsk { return bsw.CommonCrawl(domain, *flCommonCrawl, *flServerAddr) })
+			}
+			if *flCRTSH {
+				queue(func() *bsw.Tsk { return bsw.CRTSHCT(domain, *flServerAddr) })
+			}
+			if *flVT {
+				queue(func() *bsw.Tsk { return bsw.VirusTotal(domain, *flServerAddr) })
+			}
+		}
+	}
+	scanDomains(domains)
+
+	// Wait for all tasks to complete before queueing any tasks that use their results.
+	pending.Wait()
+
+	// Search for other certificates with the organizations and email addresses of the
+	// certificates found, proposing the registrable domains in them as new targets. The
+	// proposed domains are scanned when allowed or confirmed, and are then included in
+	// every pass below.
+	if *flPivot {
+		results := bsw.Results{}
+		for _, r := range resMap {
+			results = append(results, r)
+		}
+		for _, v := range bsw.PivotValues(results) {
+			value := v
+			queue(func() *bsw.Tsk { return bsw.CertificatePivot(value, domains, *flCensys) })
+		}
+		pending.Wait()
+		proposed := map[string]string{}
+		for _, d := range domainMap {
+			if d.Source == bsw.TaskCertificatePivot {
+				proposed[d.Name] = d.Info
+			}
+		}
+		names := []string{}
+		for name := range proposed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		approved := []string{}
+		stdin := bufio.NewReader(os.Stdin)
+		for _, name := range names {
+			if pivotAllow[name] {
+				approved = append(approved, name)
+				continue
+			}
+			if !*flPivotConfirm {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "\rScan %s, found by %s? [y/N] ", name, proposed[name])
+			answer, _ := stdin.ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a == "y" || a == "yes" {
+				approved = append(approved, name)
+			}
+		}
+		if skipped := len(names) - len(approved); skipped > 0 {
+			log.Printf("%d domains proposed by -pivot were not scanned, use -pivot-allow or -pivot-confirm to scan them", skipped)
+		}
+		if len(approved) > 0 {
+			log.Printf("Scanning %d domains proposed by -pivot", len(approved))
+			scanDomains(approved)
+			pending.Wait()
+			domains = append(domains, approved...)
+		}
+	}
+
+	// Generate permutations of each discovered hostname and guess them using Dictionary.
+	if *flPermute {
+		known := map[string]bool{}
+		for _, r := range resMap {
+			known[strings.ToLower(r.Hostname)] = true
+		}
+		guessed := map[string]bool{}
+		for name := range known {
+			if strings.HasPrefix(name, "*.") {
+				continue
+			}
+			for _, d := range domains {
+				d = strings.ToLower(d)
+				if !strings.HasSuffix(name, "."+d) {
+					continue
+				}
+				for _, p := range bsw.Permutations(strings.TrimSuffix(name, "."+d), permuteWords) {
+					if known[p+"."+d] || guessed[p+"."+d] {
+						continue
+					}
+					guessed[p+"."+d] = true
+					domain, sub := d, p
+					queue(func() *bsw.Tsk { return bsw.Dictionary(domain, sub, wildcards, *flServerAddr) })
+					if *flipv6 {
+						queue(func() *bsw.Tsk { return bsw.Dictionary6(domain, sub, wildcards, *flServerAddr) })
 					}
 				}
 			}
-			for _, n := range nameList {
-				sub := n
-				tasks <- func() *bsw.Tsk { return bsw.Dictionary(domain, sub, blacklist, *flServerAddr) }
+		}
+		pending.Wait()
+	}
+
+	// Learn words from every discovered hostname and guess the new ones beneath each domain.
+	if *flLearn {
+		hostnames := []string{}
+		for _, r := range resMap {
+			hostnames = append(hostnames, r.Hostname)
+		}
+		learned := bsw.LearnWords(hostnames, domains)
+		if *flLearnFile != "" {
+			if err := ioutil.WriteFile(*flLearnFile, []byte(strings.Join(learned, "\n")+"\n"), 0644); err != nil {
+				log.Fatalf("Error writing learned words to %s: %s", *flLearnFile, err.Error())
+			}
+		}
+
+		// Skip words that were already guessed using the dictionary.
+		guessed := map[string]bool{}
+		if *flDictFile != "" {
+			isLearned := map[string]bool{}
+			for _, w := range learned {
+				isLearned[w] = true
+			}
+			check := func(word string) {
+				if word = strings.ToLower(word); isLearned[word] {
+					guessed[word] = true
+				}
+			}
+			if dictList != nil {
+				for _, w := range dictList {
+					check(w)
+				}
+			} else if err := helpers.EachWord(*flDictFile, check); err != nil {
+				log.Fatal("Error reading " + *flDictFile + " " + err.Error())
+			}
+		}
+		n := 0
+		for _, w := range learned {
+			if guessed[w] {
+				continue
+			}
+			n++
+			for _, d := range domains {
+				domain, sub := d, w
+				queue(func() *bsw.Tsk { return bsw.Dictionary(domain, sub, wildcards, *flServerAddr) })
 				if *flipv6 {
-					tasks <- func() *bsw.Tsk { return bsw.Dictionary6(domain, sub, blacklist6, *flServerAddr) }
+					queue(func() *bsw.Tsk { return bsw.Dictionary6(domain, sub, wildcards, *flServerAddr) })
 				}
 			}
 		}
+		log.Printf("Learned %d words from discovered hostnames, %d of them new", len(learned), n)
+		pending.Wait()
+	}
 
-		if *flExfil {
-			tasks <- func() *bsw.Tsk { return bsw.ExfiltratedHostname(domain, *flServerAddr) }
+	// Guess names beneath discovered subdomains, one level at a time.
+	if *flRecursive > 0 {
+		nameList := dictList
+		if *flRecursiveDict != "" {
+			words, err := helpers.ReadWords(*flRecursiveDict)
+			if err != nil {
+				log.Fatal("Error reading " + *flRecursiveDict + " " + err.Error())
+			}
+			nameList = words
 		}
-		if *flSRV {
-			tasks <- func() *bsw.Tsk { return bsw.SRV(domain, *flServerAddr) }
+		searched := map[string]bool{}
+		for depth := 1; depth <= *flRecursive; depth++ {
+			// Find each subdomain depth labels below a domain, and whether any
+			// names beneath it have been discovered.
+			candidates := map[string]string{}
+			hasChildren := map[string]bool{}
+			for _, r := range resMap {
+				name := strings.ToLower(r.Hostname)
+				if strings.HasPrefix(name, "*.") {
+					continue
+				}
+				for _, d := range domains {
+					d = strings.ToLower(d)
+					for _, p := range append(helpers.ParentDomains(name, d), name) {
+						if p != name {
+							hasChildren[p] = true
+						}
+						if p != d && strings.HasSuffix(p, "."+d) && strings.Count(strings.TrimSuffix(p, "."+d), ".") == depth-1 && !searched[p] {
+							candidates[p] = d
+						}
+					}
+				}
+			}
+
+			// Check candidates concurrently, keeping at most -recursive-max subdomains.
+			var (
+				mu        sync.Mutex
+				wg        sync.WaitGroup
+				subs      []string
+				semaphore = make(chan empty, *flConcurrency)
+			)
+			for c := range candidates {
+				searched[c] = true
+				wg.Add(1)
+				semaphore <- empty{}
+				go func(name string) {
+					defer wg.Done()
+					if bsw.ShouldRecurse(name, hasChildren[name], wildcards, *flServerAddr) {
+						mu.Lock()
+						subs = append(subs, name)
+						mu.Unlock()
+					}
+					<-semaphore
+				}(c)
+			}
+			wg.Wait()
+			sort.Strings(subs)
+			if len(subs) > *flRecursiveMax {
+				log.Printf("Found %d subdomains at depth %d, only guessing beneath the first %d", len(subs), depth, *flRecursiveMax)
+				subs = subs[:*flRecursiveMax]
+			}
+
+			for _, s := range subs {
+				domain := s
+				for _, n := range nameList {
+					sub := n
+					queue(func() *bsw.Tsk { return bsw.Dictionary(domain, sub, wildcards, *flServerAddr) })
+					if *flipv6 {
+						queue(func() *bsw.Tsk { return bsw.Dictionary6(domain, sub, wildcards, *flServerAddr) })
+					}
+				}
+			}
+			pending.Wait()
 		}
-		if *flYandex != "" {
-			tasks <- func() *bsw.Tsk { return bsw.YandexAPI(domain, *flYandex, *flServerAddr) }
+	}
+
+	// Search for SRV records beneath each hostname and subdomain that has been discovered,
+	// and for the records of each Active Directory site found in a zone transfer or an SRV
+	// result beneath each domain.
+	if *flSRV {
+		names := []string{}
+		for _, r := range resMap {
+			names = append(names, r.Hostname, r.Info)
 		}
-		if *flLogonTube {
-			tasks <- func() *bsw.Tsk { return bsw.LogonTubeAPI(domain) }
+		// The names are collected before any task is queued, as tasks add to resMap.
+		searched := map[string]bool{}
+		for _, d := range domains {
+			searched[strings.ToLower(d)] = true
 		}
-		if *flShodan != "" {
-			tasks <- func() *bsw.Tsk { return bsw.ShodanAPIHostSearch(domain, *flShodan) }
+		subs := []string{}
+		for _, r := range resMap {
+			name := strings.ToLower(r.Hostname)
+			if name == "" || strings.HasPrefix(name, "*.") || strings.HasPrefix(name, "_") {
+				continue
+			}
+			for _, d := range domains {
+				if !strings.HasSuffix(name, "."+strings.ToLower(d)) {
+					continue
+				}
+				for _, p := range append(helpers.ParentDomains(name, d), name) {
+					if !searched[p] {
+						searched[p] = true
+						subs = append(subs, p)
+					}
+				}
+			}
 		}
-		if *flBing != "" && bingPath != "" {
-			tasks <- func() *bsw.Tsk { return bsw.BingAPIDomain(domain, *flBing, bingPath, *flServerAddr) }
+		sort.Slice(subs, func(i, j int) bool {
+			if li, lj := strings.Count(subs[i], "."), strings.Count(subs[j], "."); li != lj {
+				return li < lj
+			}
+			return subs[i] < subs[j]
+		})
+		if len(subs) > *flSRVMax {
+			log.Printf("Found %d names to search for SRV records beneath, only searching the first %d", len(subs), *flSRVMax)
+			subs = subs[:*flSRVMax]
 		}
-		if *flBingHTML {
-			tasks <- func() *bsw.Tsk { return bsw.BingDomain(domain, *flServerAddr) }
+		if sites := bsw.SiteNames(names); len(sites) > 0 {
+			services := bsw.SiteServices(sites)
+			for _, d := range domains {
+				domain := d
+				queue(func() *bsw.Tsk { return bsw.SRV(domain, services, *flServerAddr) })
+			}
 		}
-		if *flAXFR {
-			tasks <- func() *bsw.Tsk { return bsw.AXFR(domain, *flServerAddr) }
+		for _, s := range subs {
+			sub := s
+			queue(func() *bsw.Tsk { return bsw.SRV(sub, srvServices, *flServerAddr) })
 		}
-		if *flNS {
-			tasks <- func() *bsw.Tsk { return bsw.NS(domain, *flServerAddr) }
+		pending.Wait()
+	}
+
+	// Names used to find virtual hosts on each IP: the domains, the dictionary beneath each
+	// domain and every discovered hostname.
+	candidates := map[string]bool{}
+	if *flSNI || *flVHost {
+		for _, d := range domains {
+			candidates[strings.ToLower(d)] = true
 		}
-		if *flMX {
-			tasks <- func() *bsw.Tsk { return bsw.MX(domain, *flServerAddr) }
+		if *flDictFile != "" {
+			words := dictList
+			if words == nil {
+				w, err := helpers.ReadWords(*flDictFile)
+				if err != nil {
+					log.Fatal("Error reading " + *flDictFile + " " + err.Error())
+				}
+				words = w
+			}
+			for _, w := range words {
+				for _, d := range domains {
+					candidates[strings.ToLower(w+"."+d)] = true
+				}
+			}
 		}
-		if *flCensys != "" {
-			tasks <- func() *bsw.Tsk { return bsw.CensysDomain(domain, *flCensys) }
+		for _, r := range resMap {
+			if r.Hostname != "" && !strings.HasPrefix(r.Hostname, "*.") {
+				candidates[strings.ToLower(r.Hostname)] = true
+			}
 		}
-		if *flCommonCrawl != "" {
-			tasks <- func() *bsw.Tsk { return bsw.CommonCrawl(domain, *flCommonCrawl, *flServerAddr) }
+	}
+
+	// Handshake with each IP using each candidate for SNI, to find virtual hosts that return
+	// their own certificate. Like -vhost, the pass is skipped when it would exceed -sni-max.
+	if n := len(candidates) * len(ipAddrList); *flSNI && n > *flSNIMax {
+		log.Printf("Skipping -sni, %d names on %d IPs would require %d tasks, more than -sni-max %d", len(candidates), len(ipAddrList), n, *flSNIMax)
+	} else if *flSNI {
+		log.Printf("Handshaking with %d names on %d IPs with -sni", len(candidates), len(ipAddrList))
+		baselines := bsw.NewSNIBaselines()
+		for _, h := range ipAddrList {
+			for c := range candidates {
+				ip, name := h, c
+				queue(func() *bsw.Tsk { return bsw.SNI(ip, name, tlsPorts, baselines, *flTimeout) })
+			}
+		}
+		pending.Wait()
+	}
+
+	// Request each IP using each candidate as the Host header, to find virtual hosts that
+	// return a different response than a random name. The number of names and IPs is only
+	// known once other tasks are complete, so rather than failing the pass is skipped when
+	// it would exceed -vhost-max.
+	if n := len(candidates) * len(ipAddrList); *flVHost && n > *flVHostMax {
+		log.Printf("Skipping -vhost, %d names on %d IPs would require %d tasks, more than -vhost-max %d", len(candidates), len(ipAddrList), n, *flVHostMax)
+	} else if *flVHost {
+		log.Printf("Requesting %d names on %d IPs with -vhost", len(candidates), len(ipAddrList))
+		baselines := bsw.NewHTTPBaselines()
+		for _, h := range ipAddrList {
+			for c := range candidates {
+				ip, name := h, c
+				queue(func() *bsw.Tsk { return bsw.VHost(ip, name, baselines, *flTimeout) })
+			}
 		}
-		if *flCRTSH {
-			tasks <- func() *bsw.Tsk { return bsw.CRTSHCT(domain, *flServerAddr) }
+		pending.Wait()
+	}
+
+	// Compute a TLS fingerprint for each IP that returned a certificate, on the port it was
+	// returned on. Fingerprints are returned as results without a hostname, which are
+	// removed and used for clustering. The targets are collected before any task is queued,
+	// as tasks add to resMap.
+	fingerprints := map[string]string{}
+	if *flCluster != "" {
+		results := bsw.Results{}
+		for _, r := range resMap {
+			results = append(results, r)
+		}
+		for ip, p := range bsw.FingerprintTargets(results) {
+			ip, port := ip, p
+			queue(func() *bsw.Tsk { return bsw.TLSCluster(ip, port, *flTimeout) })
 		}
-		if *flVT {
-			tasks <- func() *bsw.Tsk { return bsw.VirusTotal(domain, *flServerAddr) }
+		pending.Wait()
+		for _, r := range resMap {
+			if r.Source == bsw.TaskTLSFingerprint {
+				fingerprints[r.IP] = r.Info
+				delete(resMap, r.Key())
+			}
 		}
 	}
 
+	// Compare the HTTP response for each dictionary result with the response for a random name.
+	// The dictionary results are collected before any task is queued, as tasks add to resMap.
+	if *flHTTPWildcard != "" {
+		dictionary := bsw.Results{}
+		for _, r := range resMap {
+			if strings.HasPrefix(r.Source, "Dictionary") {
+				dictionary = append(dictionary, r)
+			}
+		}
+		baselines := bsw.NewHTTPBaselines()
+		for _, r := range dictionary {
+			result := r
+			queue(func() *bsw.Tsk { return bsw.HTTPWildcard(result.IP, result.Hostname, baselines, *flTimeout) })
+		}
+		pending.Wait()
+		matches := make(map[bsw.Result]bool)
+		for _, r := range resMap {
+			if r.Source == bsw.TaskHTTPWildcard {
+				matches[bsw.Result{IP: r.IP, Hostname: r.Hostname}] = true
+				delete(resMap, r.Key())
+			}
+		}
+		tagged := map[bsw.ResultKey]bsw.Result{}
+		for _, r := range dictionary {
+			if !matches[bsw.Result{IP: r.IP, Hostname: r.Hostname}] {
+				continue
+			}
+			delete(resMap, r.Key())
+			if *flHTTPWildcard == "tag" {
+				r.Source += " (HTTP wildcard)"
+				tagged[r.Key()] = r
+			}
+		}
+		for k, r := range tagged {
+			resMap[k] = r
+		}
+	}
+
+	// Add any wildcards that were detected to results.
+	for _, w := range wildcards.Wildcards() {
+		wildcard := w
+		queue(func() *bsw.Tsk {
+			t := &bsw.Tsk{}
+			t.SetTask("Wildcard IPv4")
+			for _, ip := range wildcard.IPs {
+				t.AddResult(ip, "*."+wildcard.Domain)
+			}
+			t.SetTask("Wildcard IPv6")
+			for _, ip := range wildcard.IPs6 {
+				t.AddResult(ip, "*."+wildcard.Domain)
+			}
+			return t
+		})
+	}
+
 	// Close the tasks channel after all jobs have completed and for each
 	// goroutine in the pool receive an empty message from  tracker.
 	close(tasks)
@@ -675,9 +1764,66 @@ func main() {
 
 	// Create a results slice from the unique set in resMap. Allows for sorting.
 	results := bsw.Results{}
-	for k := range resMap {
-		results = append(results, k)
+	for _, r := range resMap {
+		results = append(results, r)
 	}
 	sort.Sort(results)
-	output(results, *flJSON, *flCsv, *flClean)
+
+	// Write each certificate that names were found in.
+	if *flCertDump != "" {
+		dumped := map[string]bool{}
+		for _, r := range results {
+			if r.Certificate == nil || dumped[r.Certificate.SHA256] {
+				continue
+			}
+			dumped[r.Certificate.SHA256] = true
+			if err := bsw.DumpCertificate(*flCertDump, r.Certificate); err != nil {
+				log.Printf("Error writing certificate: %s", err.Error())
+			}
+		}
+		log.Printf("Wrote %d certificates to %s", len(dumped), *flCertDump)
+	}
+
+	// Group IPs by certificate and TLS fingerprint.
+	if *flCluster != "" {
+		clusters := bsw.Clusters(results, fingerprints)
+		j, _ := json.MarshalIndent(clusters, "", "    ")
+		if err := ioutil.WriteFile(*flCluster, j, 0644); err != nil {
+			log.Printf("Error writing clusters: %s", err.Error())
+		}
+		w := tabwriter.NewWriter(os.Stderr, 0, 8, 4, ' ', 0)
+		fmt.Fprintln(w, "Kind\tKey\tIPs\tHostnames")
+		for _, c := range clusters {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", c.Kind, c.Key, len(c.IPs), strings.Join(c.Hostnames, ","))
+		}
+		w.Flush()
+		log.Printf("Wrote %d clusters to %s", len(clusters), *flCluster)
+	}
+
+	// List the domains proposed by -siblings, -typosquat and -pivot apart from the results.
+	if len(domainMap) > 0 {
+		proposed := []bsw.Domain{}
+		for _, d := range domainMap {
+			proposed = append(proposed, d)
+		}
+		sort.Slice(proposed, func(i, j int) bool {
+			if proposed[i].Name != proposed[j].Name {
+				return proposed[i].Name < proposed[j].Name
+			}
+			return proposed[i].Source < proposed[j].Source
+		})
+		w := tabwriter.NewWriter(os.Stderr, 0, 8, 4, ' ', 0)
+		fmt.Fprintln(w, "Domain\tSource\tIPs\tInfo")
+		for _, d := range proposed {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Name, d.Source, strings.Join(d.IPs, ","), d.Info)
+		}
+		w.Flush()
+	}
+	// The zone is written for the domain when only one is given, and records from
+	// -zone-file provide its SOA and NS records.
+	origin := *flZoneOrigin
+	if origin == "" && len(domains) == 1 {
+		origin = domains[0]
+	}
+	output(results, *flJSON, *flCsv, *flClean, *flZone, origin, zoneRecords)
 }
@@ -0,0 +1,36 @@
+// Package wordlists provides the wordlists built in to blacksheepwall.
+package wordlists
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+//go:embed *.txt
+var lists embed.FS
+
+// Prefix used to select a built-in list in place of a file path.
+const Prefix = "builtin:"
+
+// Names returns the name of every built-in list.
+func Names() []string {
+	names := []string{}
+	entries, _ := lists.ReadDir(".")
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open returns the built-in list with the provided name, such as small, medium, large or srv.
+func Open(name string) (io.ReadCloser, error) {
+	f, err := lists.Open(strings.ToLower(name) + ".txt")
+	if err != nil {
+		return nil, fmt.Errorf("unknown built-in wordlist %s, available lists are: %s", name, strings.Join(Names(), ", "))
+	}
+	return f, nil
+}
@@ -0,0 +1,27 @@
+package wordlists
+
+import (
+	"bufio"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	for _, name := range []string{"small", "medium", "large", "srv"} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			n++
+		}
+		f.Close()
+		if n < 100 {
+			t.Errorf("built-in list %s only has %d lines", name, n)
+		}
+	}
+	if _, err := Open("missing"); err == nil {
+		t.Error("Open did not return an error for a missing list")
+	}
+}